@@ -0,0 +1,220 @@
+package eventbus
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// WithAck makes delivery at least once: every stored event delivered to the
+// subscription must be acknowledged with Subscription.Ack, and events that
+// are not acknowledged within timeout, or that were dropped because the
+// buffer was full, are delivered again.
+//
+// Redelivered events come after the events delivered in the meantime, so
+// consumers that rely on log order should process one event at a time and
+// acknowledge it before reading the next. Subscription.Cursor tells how far
+// the consumer got, for resubscribing after a restart. Unstored events are
+// delivered once and need no acknowledgement.
+func WithAck(timeout time.Duration) SubscribeOption {
+	return func(s *subscriber) {
+		s.ack = &acker{timeout: timeout}
+	}
+}
+
+// WithParking parks the events delivered maxAttempts times without being
+// acknowledged, so that a poison event that keeps crashing or failing the
+// consumer does not wedge it: a parked event is no longer delivered, counts
+// as acknowledged for Subscription.Cursor, and is listed by
+// Subscription.Parked until Subscription.Retry delivers it again. Parking is
+// reported to WithStatus. It has no effect without WithAck.
+func WithParking(maxAttempts int) SubscribeOption {
+	return func(s *subscriber) {
+		s.parkAfter = maxAttempts
+	}
+}
+
+// acker tracks the events delivered to a subscriber that have not been
+// acknowledged yet, in log order.
+type acker struct {
+	timeout time.Duration
+
+	// parkAfter is the number of deliveries after which an event is
+	// parked, if positive.
+	parkAfter int
+
+	mu      sync.Mutex
+	pending []*inflight
+	parked  []Event
+	cursor  string
+}
+
+type inflight struct {
+	event    Event
+	due      time.Time
+	acked    bool
+	attempts int
+}
+
+// track records e as waiting for acknowledgement until due. A zero due means
+// e was not sent and is due for delivery.
+func (a *acker) track(e Event, due time.Time) {
+	if e.ID == "" {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	f := &inflight{event: e, due: due}
+	if !due.IsZero() {
+		f.attempts = 1
+	}
+	a.pending = append(a.pending, f)
+}
+
+// settle marks the event with the given ID as acknowledged, or as due for
+// redelivery if nack is true, and advances the cursor past the acknowledged
+// events at the head of the pending list.
+func (a *acker) settle(id string, nack bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, f := range a.pending {
+		if f.event.ID == id {
+			if nack {
+				f.due = time.Time{}
+			} else {
+				f.acked = true
+			}
+			break
+		}
+	}
+
+	a.advance()
+}
+
+// advance moves the cursor past the acknowledged events at the head of the
+// pending list. It must be called with a.mu held.
+func (a *acker) advance() {
+	for len(a.pending) > 0 && a.pending[0].acked {
+		// retried events come back after newer ones
+		if id := a.pending[0].event.ID; seqOf(id) > seqOf(a.cursor) {
+			a.cursor = id
+		}
+		a.pending = a.pending[1:]
+	}
+}
+
+// redeliver sends the events whose acknowledgement is overdue again, without
+// blocking. It must be called with the bus lock held, while s is registered.
+func (a *acker) redeliver(s *subscriber, now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	defer a.advance()
+
+	for _, f := range a.pending {
+		if f.acked || now.Before(f.due) {
+			continue
+		}
+
+		if a.parkAfter > 0 && f.attempts >= a.parkAfter {
+			f.acked = true
+			a.parked = append(a.parked, f.event)
+			s.notify(Status{Kind: StatusParked, Event: f.event})
+			continue
+		}
+
+		select {
+		case s.ch <- f.event:
+			f.due = now.Add(a.timeout)
+			f.attempts++
+		default:
+			return
+		}
+	}
+}
+
+// watch redelivers overdue events until the subscriber is unregistered.
+func (b *Bus) watch(s *subscriber) {
+	ticker := time.NewTicker(max(s.ack.timeout/4, 10*time.Millisecond))
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		b.mu.Lock()
+		if _, ok := b.subscribers[s]; !ok {
+			b.mu.Unlock()
+			return
+		}
+		s.ack.redeliver(s, now)
+		b.mu.Unlock()
+	}
+}
+
+// Ack acknowledges e, so that it is not delivered again. It has no effect
+// unless the subscription was created with WithAck.
+func (s *Subscription) Ack(e Event) {
+	if s.sub.ack != nil {
+		s.sub.ack.settle(e.ID, false)
+	}
+}
+
+// Nack reports that e could not be processed, so that it is delivered again
+// without waiting for the acknowledgement timeout. It has no effect unless
+// the subscription was created with WithAck.
+func (s *Subscription) Nack(e Event) {
+	if s.sub.ack != nil {
+		s.sub.ack.settle(e.ID, true)
+	}
+}
+
+// Cursor returns the ID of the last event such that it and every event
+// delivered before it have been acknowledged, or the fromID of the
+// subscription if there is none yet. Resubscribing from Cursor delivers every
+// event that was not acknowledged. It returns the empty string unless the
+// subscription was created with WithAck.
+func (s *Subscription) Cursor() string {
+	if s.sub.ack == nil {
+		return ""
+	}
+
+	s.sub.ack.mu.Lock()
+	defer s.sub.ack.mu.Unlock()
+
+	return s.sub.ack.cursor
+}
+
+// Parked returns the events parked because of WithParking, oldest first.
+func (s *Subscription) Parked() []Event {
+	if s.sub.ack == nil {
+		return nil
+	}
+
+	s.sub.ack.mu.Lock()
+	defer s.sub.ack.mu.Unlock()
+
+	return append([]Event(nil), s.sub.ack.parked...)
+}
+
+// Retry delivers a parked event again, with as many attempts as the first
+// time before it is parked again. It returns ErrNotFound if no event with
+// that ID is parked.
+func (s *Subscription) Retry(id string) error {
+	a := s.sub.ack
+	if a == nil {
+		return ErrNotFound
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	i := slices.IndexFunc(a.parked, func(e Event) bool { return e.ID == id })
+	if i < 0 {
+		return ErrNotFound
+	}
+
+	a.pending = append(a.pending, &inflight{event: a.parked[i]})
+	a.parked = slices.Delete(a.parked, i, i+1)
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package eventbus
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// AdminHandler returns an HTTP handler to inspect and tune a running bus,
+// meant to be mounted on an internal port:
+//
+//	GET    /events?filter=X          events matching expression X, see Expr
+//	GET    /handlers                 statistics of every handler
+//	GET    /subscribers              lag of every subscriber, see SubscriberLags
+//	GET    /trace?topic=P            entries traced for pattern P
+//	POST   /trace?topic=P&limit=N    start tracing pattern P
+//	DELETE /trace?topic=P            stop tracing pattern P
+//
+// GET /events also takes after=ID to page through the log, and limit=N,
+// which defaults to 100. Responses are JSON. Mount it under a prefix with http.StripPrefix.
+func (b *Bus) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /events", func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		q := Query{AfterID: params.Get("after"), Limit: 100}
+		if s := params.Get("limit"); s != "" {
+			var err error
+			if q.Limit, err = strconv.Atoi(s); err != nil {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+		}
+		if s := params.Get("filter"); s != "" {
+			var err error
+			if q.Expr, err = CompileExpr(s); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		events := []Event{}
+		b.ForEachEvent(q, func(e Event) { events = append(events, e) })
+		writeJSON(w, events)
+	})
+
+	mux.HandleFunc("GET /handlers", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, b.HandlerStats())
+	})
+
+	mux.HandleFunc("GET /subscribers", func(w http.ResponseWriter, r *http.Request) {
+		type subscriber struct {
+			ID       uint64 `json:"id"`
+			Name     string `json:"name,omitempty"`
+			LastID   string `json:"last_id"`
+			Buffered int    `json:"buffered"`
+			Behind   int    `json:"behind"`
+			Dropped  uint64 `json:"dropped"`
+		}
+
+		// queries hold functions, which do not encode
+		lags := b.SubscriberLags()
+		subs := make([]subscriber, len(lags))
+		for i, l := range lags {
+			subs[i] = subscriber{l.ID, l.Name, l.LastID, l.Buffered, l.Behind, l.Dropped}
+		}
+		writeJSON(w, subs)
+	})
+
+	mux.HandleFunc("GET /trace", func(w http.ResponseWriter, r *http.Request) {
+		entries := b.TopicTrace(r.URL.Query().Get("topic"))
+		if entries == nil {
+			http.Error(w, "topic not traced", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, entries)
+	})
+
+	mux.HandleFunc("POST /trace", func(w http.ResponseWriter, r *http.Request) {
+		limit := 0
+		if s := r.URL.Query().Get("limit"); s != "" {
+			var err error
+			if limit, err = strconv.Atoi(s); err != nil {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+		}
+
+		if err := b.TraceTopic(r.URL.Query().Get("topic"), limit); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("DELETE /trace", func(w http.ResponseWriter, r *http.Request) {
+		b.UntraceTopic(r.URL.Query().Get("topic"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
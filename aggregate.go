@@ -0,0 +1,169 @@
+package eventbus
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Distinct returns the distinct values of project over the events that match
+// q, in order of first appearance.
+//
+// The log is scanned in a single pass under the bus read lock, without copying
+// events. project must therefore be fast and must not call back into the bus.
+func Distinct[K comparable](b *Bus, q Query, project func(Event) K) []K {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	start, ok, _ := b.start(q.AfterID)
+	if !ok {
+		return nil
+	}
+
+	seen := make(map[K]struct{})
+	var values []K
+	b.scan(start, b.bound(q.BeforeID), q, func(e Event) {
+		v := project(e)
+		if _, dup := seen[v]; dup {
+			return
+		}
+		seen[v] = struct{}{}
+		values = append(values, v)
+	})
+
+	return values
+}
+
+// Count returns the number of events that match q, as ForEachEvent would
+// pass to its callback, without copying them.
+func (b *Bus) Count(q Query) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	start, ok, _ := b.start(q.AfterID)
+	if !ok {
+		return 0
+	}
+
+	n := 0
+	b.scan(start, b.bound(q.BeforeID), q, func(Event) { n++ })
+
+	n = max(n-q.Offset, 0)
+	if q.Limit > 0 {
+		n = min(n, q.Limit)
+	}
+
+	return n
+}
+
+// Topics returns the topics that have events in the log, sorted.
+func (b *Bus) Topics() []string {
+	return slices.Sorted(maps.Keys(b.TopicHeads()))
+}
+
+// TopicHeads returns the number of events and the last event ID of every
+// topic that has events in the log.
+func (b *Bus) TopicHeads() map[string]TopicHead {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.heads()
+}
+
+// heads summarizes every topic of the log. It must be called with b.mu held.
+func (b *Bus) heads() map[string]TopicHead {
+	heads := make(map[string]TopicHead, len(b.indexByTopic))
+	for topic, idx := range b.indexByTopic {
+		heads[topic] = TopicHead{Events: len(idx), LastID: b.events[idx[len(idx)-1]].ID}
+	}
+
+	return heads
+}
+
+// Types returns the distinct event types of a topic, sorted. topic can be a
+// pattern, as in Query.Topic, and AllTopics returns the types of every
+// topic.
+func (b *Bus) Types(topic string) []string {
+	types := Distinct(b, Query{Topic: topic}, func(e Event) string { return e.Type })
+	slices.Sort(types)
+
+	return types
+}
+
+// Fold replays the events that match q into a state, starting from initial
+// and applying each event in turn, which is how aggregates and read models
+// rebuild themselves:
+//
+//	balance, lastID := eventbus.Fold(bus, eventbus.Query{Topic: topic}, 0,
+//		func(balance int, e eventbus.Event) int { ... })
+//
+// It also returns the ID of the last event applied, or q.AfterID, or Start,
+// if there is none, to pass as lastID when publishing the next event. Events
+// are read like ForEachEvent, so apply can call back into the bus.
+func Fold[S any](b *Bus, q Query, initial S, apply func(S, Event) S) (S, string) {
+	b.mu.RLock()
+	events := b.filter(q)
+	lastID := q.AfterID
+	if lastID == "" && b.truncatedSeq > 0 {
+		lastID = strconv.FormatUint(b.truncatedSeq, 10)
+	}
+	b.mu.RUnlock()
+
+	state := initial
+	for _, e := range events {
+		state = apply(state, e)
+		lastID = e.ID
+	}
+
+	return state, lastID
+}
+
+// Joined is a pair of events correlated by Join.
+type Joined struct {
+	Left  Event
+	Right Event
+}
+
+// Join correlates the events matching left with those matching right that
+// have the same key, such as orders and their payments by order ID:
+//
+//	pairs := eventbus.Join(bus,
+//		eventbus.Query{Topic: "orders"}, func(e eventbus.Event) string { return e.Payload.(Order).ID },
+//		eventbus.Query{Topic: "payments"}, func(e eventbus.Event) string { return e.Payload.(Payment).OrderID })
+//
+// It returns a pair for each left and right event with equal keys, ordered
+// by left event, then by right event, in log order. Events without a match on
+// the other side are left out. Both sides are read at the same point in the
+// log, and the key functions are called without holding the bus lock.
+func Join[K comparable](b *Bus, left Query, leftKey func(Event) K, right Query, rightKey func(Event) K) []Joined {
+	b.mu.RLock()
+	lefts, rights := b.filter(left), b.filter(right)
+	b.mu.RUnlock()
+
+	byKey := make(map[K][]Event)
+	for _, e := range rights {
+		k := rightKey(e)
+		byKey[k] = append(byKey[k], e)
+	}
+
+	var pairs []Joined
+	for _, l := range lefts {
+		for _, r := range byKey[leftKey(l)] {
+			pairs = append(pairs, Joined{Left: l, Right: r})
+		}
+	}
+
+	return pairs
+}
+
+// StateAt rebuilds the state of a topic as of a past moment, such as the
+// balance of an account on March 1st, by folding apply over the events of
+// topic whose timestamp is not after at, starting from the zero value of S.
+// Expired and removed events are not part of the state.
+func StateAt[S any](b *Bus, topic string, at time.Time, apply func(S, Event) S) S {
+	var initial S
+	state, _ := Fold(b, Query{Topic: topic, Until: at.Add(time.Nanosecond)}, initial, apply)
+
+	return state
+}
@@ -0,0 +1,79 @@
+package eventbus
+
+import "time"
+
+// AutoSave dumps the bus to path every interval, in the background, until
+// Close is called, so that a crash loses at most the last interval of events.
+// Calling AutoSave again replaces the previous one, and calling it with an
+// interval that is not positive only stops the previous one.
+//
+// Each save goes through SaveToFile with opts, so the previous save stays
+// intact if the process dies in the middle of a write. Intervals without
+// changes are skipped, and a save that fails is retried on the next tick.
+// Events published after the last save are not written on Close: call
+// SaveToFile after Close to persist them.
+func (b *Bus) AutoSave(path string, interval time.Duration, opts ...SaveOption) {
+	stop := make(chan struct{})
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	if b.autosave != nil {
+		close(b.autosave)
+		b.autosave = nil
+	}
+	if interval <= 0 {
+		b.mu.Unlock()
+		return
+	}
+	b.autosave = stop
+	b.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var saved saveState
+		for {
+			select {
+			case <-ticker.C:
+				state := b.saveState()
+				if state == saved {
+					continue
+				}
+				if err := b.SaveToFile(path, opts...); err == nil {
+					saved = state
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// saveState sums up what a dump holds, to tell whether the bus changed since
+// the last save.
+type saveState struct {
+	seq          uint64
+	trimmedSeq   uint64
+	truncatedSeq uint64
+	events       int
+	scheduleSeq  uint64
+	scheduled    int
+}
+
+func (b *Bus) saveState() saveState {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return saveState{
+		seq:          b.seq,
+		trimmedSeq:   b.trimmedSeq,
+		truncatedSeq: b.truncatedSeq,
+		events:       len(b.events),
+		scheduleSeq:  b.schedule.seq,
+		scheduled:    b.schedule.Len(),
+	}
+}
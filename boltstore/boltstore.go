@@ -0,0 +1,269 @@
+// Package boltstore implements eventbus.Store on bbolt, for durable storage
+// in a single file, in pure Go, without a database server:
+//
+//	db, err := bolt.Open("events.db", 0o600, nil)
+//	...
+//	store, err := boltstore.Open(db)
+//	...
+//	bus, err := eventbus.NewWithStore(store)
+//
+// Events are stored as JSON in an events bucket, keyed by their sequence
+// number as a big-endian uint64 so that the key order is the log order, and
+// indexed by topic in a bucket per topic of the topics bucket. Payloads are
+// recovered as generic JSON values, as with eventbus.Load.
+//
+// The package is a module of its own, so that the bus does not depend on
+// bbolt.
+package boltstore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lobre/eventbus"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	eventsBucket = []byte("events")
+	topicsBucket = []byte("topics")
+)
+
+// Store is an eventbus.Store backed by a bbolt database.
+type Store struct {
+	db *bolt.DB
+
+	mu     sync.Mutex
+	lastID string
+	n      int
+}
+
+// Open creates the buckets of the store in db if needed, and returns a Store
+// using them. The caller keeps ownership of db and closes it after the bus.
+func Open(db *bolt.DB) (*Store, error) {
+	s := &Store{db: db}
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		events, err := tx.CreateBucketIfNotExists(eventsBucket)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(topicsBucket); err != nil {
+			return err
+		}
+
+		s.n = events.Stats().KeyN
+		if k, _ := events.Cursor().Last(); k != nil {
+			s.lastID = strconv.FormatUint(binary.BigEndian.Uint64(k), 10)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("boltstore: open: %w", err)
+	}
+
+	return s, nil
+}
+
+// Append implements eventbus.Store. Events are written in a single
+// transaction.
+func (s *Store) Append(events ...eventbus.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(eventsBucket)
+		topics := tx.Bucket(topicsBucket)
+
+		for _, e := range events {
+			key, err := keyOf(e.ID)
+			if err != nil {
+				return err
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+
+			if err := bucket.Put(key, data); err != nil {
+				return err
+			}
+			topic, err := topics.CreateBucketIfNotExists([]byte(e.Topic))
+			if err != nil {
+				return err
+			}
+			if err := topic.Put(key, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.lastID = events[len(events)-1].ID
+	s.n += len(events)
+
+	return nil
+}
+
+// ReadAfter implements eventbus.Store.
+func (s *Store) ReadAfter(id string, fn func(eventbus.Event) error) error {
+	from, err := keyAfter(id)
+	if err != nil {
+		return err
+	}
+
+	return s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(eventsBucket).Cursor()
+		for k, v := c.Seek(from); k != nil; k, v = c.Next() {
+			var e eventbus.Event
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// LastID implements eventbus.Store.
+func (s *Store) LastID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lastID
+}
+
+// Len implements eventbus.Store.
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.n
+}
+
+// Events returns the stored events that match q, straight from the
+// database, including those the bus removed from memory. A single topic is
+// read from its index, and AfterID, BeforeID and Reverse bound the keys
+// read; the other filters of q are then applied to the events, as well as
+// Offset and Limit. Expired events are skipped.
+func (s *Store) Events(q eventbus.Query) ([]eventbus.Event, error) {
+	from, err := keyAfter(q.AfterID)
+	if err != nil {
+		return nil, err
+	}
+	var to []byte
+	if q.BeforeID != "" {
+		if to, err = keyOf(q.BeforeID); err != nil {
+			return nil, err
+		}
+	}
+
+	var events []eventbus.Event
+	err = s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(eventsBucket)
+
+		// keys are read from the index of the topic if there is a single
+		// one, and from the events themselves otherwise
+		index := bucket
+		if q.Topic != "" && q.Topic != eventbus.AllTopics && len(q.Topics) == 0 && !strings.Contains(q.Topic, "*") {
+			index = tx.Bucket(topicsBucket).Bucket([]byte(q.Topic))
+			if index == nil {
+				return nil
+			}
+		}
+
+		now := time.Now()
+		skip := q.Offset
+		for key := range keys(index.Cursor(), from, to, q.Reverse) {
+			var e eventbus.Event
+			if err := json.Unmarshal(bucket.Get(key), &e); err != nil {
+				return err
+			}
+			if !e.ExpiresAt.IsZero() && !now.Before(e.ExpiresAt) || !q.Match(e) {
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+
+			events = append(events, e)
+			if len(events) == q.Limit {
+				break
+			}
+		}
+		return nil
+	})
+
+	return events, err
+}
+
+// keys iterates over the keys of c from from, included, to to, excluded, in
+// reverse order if reverse is true. A nil to is the end of the bucket.
+func keys(c *bolt.Cursor, from, to []byte, reverse bool) iter.Seq[[]byte] {
+	return func(yield func([]byte) bool) {
+		if !reverse {
+			for k, _ := c.Seek(from); k != nil && (to == nil || bytes.Compare(k, to) < 0); k, _ = c.Next() {
+				if !yield(k) {
+					return
+				}
+			}
+			return
+		}
+
+		k, _ := c.Last()
+		if to != nil {
+			// Seek lands on to or after it, so the key before is the last
+			// one to read
+			if k, _ = c.Seek(to); k == nil {
+				k, _ = c.Last()
+			} else {
+				k, _ = c.Prev()
+			}
+		}
+		for ; k != nil && bytes.Compare(k, from) >= 0; k, _ = c.Prev() {
+			if !yield(k) {
+				return
+			}
+		}
+	}
+}
+
+// keyOf returns the key of an event ID.
+func keyOf(id string) ([]byte, error) {
+	seq, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("boltstore: invalid id %q", id)
+	}
+	return binary.BigEndian.AppendUint64(nil, seq), nil
+}
+
+// keyAfter returns the key following the one of an event ID, or the first
+// key for the empty string.
+func keyAfter(id string) ([]byte, error) {
+	if id == "" {
+		return binary.BigEndian.AppendUint64(nil, 0), nil
+	}
+
+	key, err := keyOf(id)
+	if err != nil {
+		return nil, err
+	}
+	return binary.BigEndian.AppendUint64(nil, binary.BigEndian.Uint64(key)+1), nil
+}
@@ -0,0 +1,13 @@
+module github.com/lobre/eventbus/boltstore
+
+go 1.25.1
+
+require (
+	github.com/lobre/eventbus v0.0.0
+	go.etcd.io/bbolt v1.5.0
+)
+
+require golang.org/x/sys v0.45.0 // indirect
+
+// the store is developed along with the bus
+replace github.com/lobre/eventbus => ../
@@ -0,0 +1,130 @@
+package eventbus
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// Checkpoint records how far a named consumer got in the log.
+type Checkpoint struct {
+	// LastID is the ID of the last event the consumer is done with.
+	LastID string `json:"last_id"`
+
+	// PendingID is the ID of the event the consumer was processing when the
+	// checkpoint was saved, and Attempts is how many times processing that
+	// event was started, including across restarts. A consumer that crashes
+	// while processing an event leaves them behind.
+	PendingID string `json:"pending_id,omitempty"`
+	Attempts  int    `json:"attempts,omitempty"`
+}
+
+// CheckpointStore persists checkpoints by consumer name.
+type CheckpointStore interface {
+	// Load returns the checkpoint saved for name, or a zero Checkpoint if
+	// there is none.
+	Load(name string) (Checkpoint, error)
+
+	// Save replaces the checkpoint for name.
+	Save(name string, cp Checkpoint) error
+}
+
+// MemoryCheckpoints is a CheckpointStore that keeps checkpoints in memory.
+// It survives restarting a handler, but not the process.
+type MemoryCheckpoints struct {
+	mu          sync.Mutex
+	checkpoints map[string]Checkpoint
+}
+
+// NewMemoryCheckpoints creates an empty MemoryCheckpoints.
+func NewMemoryCheckpoints() *MemoryCheckpoints {
+	return &MemoryCheckpoints{checkpoints: make(map[string]Checkpoint)}
+}
+
+// Load implements CheckpointStore.
+func (m *MemoryCheckpoints) Load(name string) (Checkpoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.checkpoints[name], nil
+}
+
+// Save implements CheckpointStore.
+func (m *MemoryCheckpoints) Save(name string, cp Checkpoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.checkpoints[name] = cp
+	return nil
+}
+
+// FileCheckpoints is a CheckpointStore that keeps all checkpoints in a single
+// JSON file, rewritten on every Save through a temporary file, like
+// SaveToFile.
+type FileCheckpoints struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileCheckpoints creates a FileCheckpoints backed by the file at path.
+// The file is created on the first Save if it does not exist, readable and
+// writable by its owner only.
+func NewFileCheckpoints(path string) *FileCheckpoints {
+	return &FileCheckpoints{path: path}
+}
+
+// Load implements CheckpointStore.
+func (f *FileCheckpoints) Load(name string) (Checkpoint, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	checkpoints, err := f.read()
+	if err != nil {
+		return Checkpoint{}, err
+	}
+
+	return checkpoints[name], nil
+}
+
+// Save implements CheckpointStore.
+func (f *FileCheckpoints) Save(name string, cp Checkpoint) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	checkpoints, err := f.read()
+	if err != nil {
+		return err
+	}
+	checkpoints[name] = cp
+
+	data, err := json.MarshalIndent(checkpoints, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// a crash must not leave a truncated file behind, which would lose
+	// every checkpoint
+	return writeFileAtomic(f.path, false, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+func (f *FileCheckpoints) read() (map[string]Checkpoint, error) {
+	checkpoints := make(map[string]Checkpoint)
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return checkpoints, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &checkpoints); err != nil {
+		return nil, err
+	}
+
+	return checkpoints, nil
+}
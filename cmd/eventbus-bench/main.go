@@ -0,0 +1,150 @@
+// Command eventbus-bench measures how a bus holds up under a publish and
+// subscribe workload, to plan capacity.
+//
+// Usage:
+//
+//	eventbus-bench [flags]
+//
+// Publishers append events of the given payload size to a set of topics, on
+// an embedded bus, while subscribers follow every topic. It reports the
+// publish throughput, the latency from publish to receipt and how many
+// events subscribers dropped. Run with -h for the flags.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lobre/eventbus"
+)
+
+type payload struct {
+	Sent time.Time
+	Data []byte
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("eventbus-bench: ")
+
+	events := flag.Int("events", 100000, "number of events to publish")
+	topics := flag.Int("topics", 100, "number of topics")
+	publishers := flag.Int("publishers", 4, "number of concurrent publishers")
+	subscribers := flag.Int("subscribers", 4, "number of subscribers to every topic")
+	buffer := flag.Int("buffer", 1024, "buffer size of each subscriber")
+	size := flag.Int("payload", 128, "payload size in bytes")
+	unstored := flag.Bool("unstored", false, "publish with PublishUnstored")
+	flag.Parse()
+
+	if *events < 1 || *topics < 1 || *publishers < 1 || *subscribers < 0 || *buffer < 0 || *size < 0 {
+		log.Fatal("invalid flags")
+	}
+
+	bus := eventbus.New()
+
+	subs := make([]*eventbus.Subscription, *subscribers)
+	latencies := make([][]time.Duration, *subscribers)
+	var received sync.WaitGroup
+	for i := range subs {
+		sub, err := bus.SubscribeWithBufferSize(eventbus.AllTopics, bus.End(), *buffer)
+		if err != nil {
+			log.Fatal(err)
+		}
+		subs[i] = sub
+
+		received.Add(1)
+		go func(i int) {
+			defer received.Done()
+			for e := range sub.C {
+				latencies[i] = append(latencies[i], time.Since(e.Payload.(payload).Sent))
+			}
+		}(i)
+	}
+
+	var conflicts atomic.Uint64
+	var published sync.WaitGroup
+	start := time.Now()
+	for p := range *publishers {
+		published.Add(1)
+		go func(p int) {
+			defer published.Done()
+			data := make([]byte, *size)
+
+			// publishers own distinct topics when there are enough of them,
+			// so that they rarely conflict
+			var owned []string
+			for t := p % *topics; t < *topics; t += *publishers {
+				owned = append(owned, fmt.Sprintf("topic-%d", t))
+			}
+			lastIDs := make(map[string]string)
+
+			for n := p; n < *events; n += *publishers {
+				topic := owned[(n / *publishers)%len(owned)]
+				pl := payload{Sent: time.Now(), Data: data}
+
+				if *unstored {
+					if err := bus.PublishUnstored(topic, "bench", pl); err != nil {
+						log.Fatal(err)
+					}
+					continue
+				}
+
+				for {
+					id, err := bus.Publish(topic, "bench", pl, lastIDs[topic])
+					if errors.Is(err, eventbus.ErrConflict) {
+						conflicts.Add(1)
+						lastIDs[topic] = bus.EndOf(topic)
+						continue
+					}
+					if err != nil {
+						log.Fatal(err)
+					}
+					lastIDs[topic] = id
+					break
+				}
+			}
+		}(p)
+	}
+	published.Wait()
+	elapsed := time.Since(start)
+
+	for _, sub := range subs {
+		sub.Close()
+	}
+	received.Wait()
+
+	fmt.Printf("published  %d events in %v (%.0f events/s)\n", *events, elapsed.Round(time.Millisecond), float64(*events)/elapsed.Seconds())
+	if n := conflicts.Load(); n > 0 {
+		fmt.Printf("conflicts  %d\n", n)
+	}
+
+	if *subscribers == 0 {
+		return
+	}
+
+	var all []time.Duration
+	var dropped uint64
+	for i, sub := range subs {
+		all = append(all, latencies[i]...)
+		dropped += sub.Dropped()
+	}
+	slices.Sort(all)
+
+	expected := uint64(*events) * uint64(*subscribers)
+	fmt.Printf("delivered  %d of %d (%.2f%% dropped)\n", len(all), expected, 100*float64(dropped)/float64(expected))
+	if len(all) > 0 {
+		fmt.Printf("latency    p50 %v  p90 %v  p99 %v  max %v\n",
+			percentile(all, 50), percentile(all, 90), percentile(all, 99), all[len(all)-1])
+	}
+}
+
+// percentile returns the p-th percentile of sorted durations.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	return sorted[(len(sorted)-1)*p/100]
+}
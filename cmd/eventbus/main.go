@@ -0,0 +1,59 @@
+// Command eventbus provides maintenance tools for persisted event logs.
+//
+// Usage:
+//
+//	eventbus migrate -from SOURCE -to DESTINATION
+//
+// SOURCE and DESTINATION are either JSON files, WAL files ending in .wal,
+// or http(s) URLs of servers returning the dump on GET and replacing it on
+// PUT. SQLite databases need a driver, and are only supported from the
+// eventbus.Migrate API, through a StoreBackend.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/lobre/eventbus"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("eventbus: ")
+
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "migrate":
+		migrate(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: eventbus migrate -from SOURCE -to DESTINATION")
+	os.Exit(2)
+}
+
+func migrate(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	from := fs.String("from", "", "source file or URL")
+	to := fs.String("to", "", "destination file or URL")
+	fs.Parse(args)
+
+	if *from == "" || *to == "" {
+		usage()
+	}
+
+	report, err := eventbus.Migrate(eventbus.ParseBackend(*to), eventbus.ParseBackend(*from))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("migrated %d events across %d topics\n", report.Events, len(report.Topics))
+}
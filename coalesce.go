@@ -0,0 +1,97 @@
+package eventbus
+
+// WithCoalesce makes a slow subscriber skip to the latest event of each key
+// instead of dropping events arbitrarily: while the consumer is busy, an
+// event replaces the pending event with the same key, as returned by key, so
+// that the consumer always ends up with the most recent state of every key.
+//
+// Pending events are delivered in the order their key first became pending,
+// each with the latest value for its key. Closing the subscription drops
+// those the consumer has yet to receive, so that nothing waits for a
+// consumer that stopped reading. Closing the bus still delivers them, and
+// Shutdown waits for the consumer to receive them until its context is done.
+//
+// Replaced events are counted by Subscription.Dropped and reported to
+// WithOnDrop and WithStatus, from the goroutine that relays the events rather
+// than with the bus lock held. It does not combine with WithAck, as replaced
+// events are never acknowledged.
+func WithCoalesce(key func(Event) string) SubscribeOption {
+	return func(s *subscriber) {
+		s.coalesce = key
+	}
+}
+
+// coalesced returns a channel relaying the events of in, which it reads as
+// they come, keeping only the latest pending event per key until the
+// consumer receives it. Once in is closed, the pending events are still
+// sent before the channel is closed, like those left in a buffer, unless the
+// subscriber gives up on them, see abandon. The subscriber is then
+// finished, unless an option such as a handler says otherwise. It must be
+// called with the bus lock held.
+func (s *subscriber) coalesced(in <-chan Event) <-chan Event {
+	out := make(chan Event)
+	s.giveUp = make(chan struct{})
+
+	done := make(chan struct{})
+	if s.finished == nil {
+		s.finished = done
+	}
+
+	go func() {
+		defer close(done)
+		defer close(out)
+
+		pending := make(map[string]Event)
+		var keys []string
+
+		for {
+			var next Event
+			var send chan<- Event
+			if len(keys) > 0 {
+				next = pending[keys[0]]
+				send = out
+			}
+
+			select {
+			case e, ok := <-in:
+				if !ok {
+					for _, k := range keys {
+						select {
+						case out <- pending[k]:
+						case <-s.giveUp:
+							return
+						}
+					}
+					return
+				}
+
+				k := s.coalesce(e)
+				if old, ok := pending[k]; ok {
+					s.dropped.Add(1)
+					if s.onDrop != nil {
+						s.onDrop(old)
+					}
+					s.notify(Status{Kind: StatusDropped, Event: old})
+				} else {
+					keys = append(keys, k)
+				}
+				pending[k] = e
+
+			case send <- next:
+				delete(pending, keys[0])
+				keys = keys[1:]
+			}
+		}
+	}()
+
+	return out
+}
+
+// abandon makes the relay of a coalescing subscriber drop the events it has
+// yet to send once its channel is closed, so that it does not wait for a
+// consumer that stopped reading.
+func (s *subscriber) abandon() {
+	if s.giveUp != nil {
+		s.giveUpOnce.Do(func() { close(s.giveUp) })
+	}
+}
@@ -0,0 +1,202 @@
+package eventbus
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Codec compresses the dumps exchanged with remote backends. Its name is used
+// as HTTP content coding, so it should match the registered names where they
+// exist, such as "gzip", "zstd" or "snappy".
+type Codec interface {
+	Name() string
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{"gzip": gzipCodec{}}
+)
+
+// RegisterCodec makes a codec available for negotiation, replacing any codec
+// with the same name. gzip is registered by default; codecs such as zstd or
+// snappy can be plugged in from third-party packages.
+func RegisterCodec(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+
+	codecs[c.Name()] = c
+}
+
+// LookupCodec returns the registered codec with the given name.
+func LookupCodec(name string) (Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	c, ok := codecs[name]
+	return c, ok
+}
+
+// codecNames returns the names of the registered codecs, sorted, as used in
+// Accept-Encoding headers.
+func codecNames() string {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	names := make([]string, 0, len(codecs))
+	for name := range codecs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return strings.Join(names, ", ")
+}
+
+// codecFormats lists how to recognize the dumps of well-known codecs, by
+// file extension and by the magic bytes their streams start with. Codecs
+// other than gzip are only used if they are registered.
+var codecFormats = []struct {
+	name  string
+	ext   string
+	magic string
+}{
+	{"gzip", ".gz", "\x1f\x8b"},
+	{"zstd", ".zst", "\x28\xb5\x2f\xfd"},
+	{"snappy", ".sz", "\xff\x06\x00\x00sNaPpY"},
+}
+
+// codecForExt returns the name of the codec of a file extension, or the empty
+// string for uncompressed files.
+func codecForExt(path string) string {
+	for _, f := range codecFormats {
+		if strings.HasSuffix(path, f.ext) {
+			return f.name
+		}
+	}
+	return ""
+}
+
+// codecForMagic returns the name of the codec whose stream starts like head,
+// or the empty string if head does not look compressed.
+func codecForMagic(head []byte) string {
+	for _, f := range codecFormats {
+		if strings.HasPrefix(string(head), f.magic) {
+			return f.name
+		}
+	}
+	return ""
+}
+
+// lookupCodec is like LookupCodec, but returns an error for unknown names.
+func lookupCodec(name string) (Codec, error) {
+	c, ok := LookupCodec(name)
+	if !ok {
+		return nil, fmt.Errorf("eventbus: unknown codec %q", name)
+	}
+	return c, nil
+}
+
+// DumpCompressed writes the same document as Dump to w, compressed with the
+// registered codec of the given name, such as "gzip". Event logs are very
+// repetitive, so this typically shrinks them several times. With a keyring,
+// the compressed document is then encrypted.
+func (b *Bus) DumpCompressed(w io.Writer, codec string) error {
+	c, err := lookupCodec(codec)
+	if err != nil {
+		return err
+	}
+
+	view := b.Snapshot()
+	ew, err := view.keyring.encrypter(w)
+	if err != nil {
+		return err
+	}
+	cw, err := c.NewWriter(ew)
+	if err != nil {
+		return err
+	}
+	if err := view.dump(cw); err != nil {
+		cw.Close()
+		return err
+	}
+	if err := cw.Close(); err != nil {
+		return err
+	}
+
+	return ew.Close()
+}
+
+// LoadCompressed reads a document written by DumpCompressed with the same
+// codec, and replaces the log like Load does.
+func (b *Bus) LoadCompressed(r io.Reader, codec string) error {
+	c, err := lookupCodec(codec)
+	if err != nil {
+		return err
+	}
+
+	r, err = b.keys().decrypter(r)
+	if err != nil {
+		return err
+	}
+	cr, err := c.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer cr.Close()
+
+	return b.Load(cr)
+}
+
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string { return "gzip" }
+
+func (gzipCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(w), nil
+}
+
+func (gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// TransferStats counts the bytes exchanged with a remote backend, before and
+// after compression. It is safe for concurrent use.
+type TransferStats struct {
+	raw  atomic.Int64
+	wire atomic.Int64
+}
+
+// RawBytes returns the size of the dumps before compression.
+func (s *TransferStats) RawBytes() int64 { return s.raw.Load() }
+
+// WireBytes returns the number of bytes actually transferred.
+func (s *TransferStats) WireBytes() int64 { return s.wire.Load() }
+
+// Saved returns the number of bytes compression saved.
+func (s *TransferStats) Saved() int64 { return s.RawBytes() - s.WireBytes() }
+
+func (s *TransferStats) add(raw, wire int) {
+	if s == nil {
+		return
+	}
+	s.raw.Add(int64(raw))
+	s.wire.Add(int64(wire))
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
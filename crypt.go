@@ -0,0 +1,303 @@
+package eventbus
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Keyring holds the AES keys used to encrypt dumps and WAL files at rest.
+//
+// New output is encrypted with the current key, and records the ID of that
+// key so that it can be decrypted with any keyring holding it. To rotate
+// keys, create a keyring with the new key and Add the previous ones, so that
+// older files still load.
+type Keyring struct {
+	current string
+
+	mu    sync.RWMutex
+	aeads map[string]cipher.AEAD
+}
+
+// NewKeyring returns a keyring that encrypts with key, known by id. The key
+// must be 16, 24 or 32 bytes long, to select AES-128, AES-192 or AES-256.
+// The id is stored in clear in encrypted files, and must not be longer than
+// 255 bytes.
+func NewKeyring(id string, key []byte) (*Keyring, error) {
+	k := &Keyring{current: id, aeads: make(map[string]cipher.AEAD)}
+	if err := k.Add(id, key); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Add makes key available to decrypt files encrypted with it under id.
+func (k *Keyring) Add(id string, key []byte) error {
+	if len(id) > 255 {
+		return fmt.Errorf("eventbus: key id %q too long", id)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return fmt.Errorf("eventbus: key %q: %w", id, err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.aeads[id] = aead
+	return nil
+}
+
+func (k *Keyring) aead(id string) (cipher.AEAD, error) {
+	if k == nil {
+		return nil, fmt.Errorf("%w: no keyring", ErrDecrypt)
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	aead, ok := k.aeads[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrDecrypt, id)
+	}
+	return aead, nil
+}
+
+// seal encrypts a single message, such as a WAL line, as the key ID, a
+// random nonce and the ciphertext.
+func (k *Keyring) seal(plaintext []byte) ([]byte, error) {
+	aead, err := k.aead(k.current)
+	if err != nil {
+		return nil, err
+	}
+
+	out := append([]byte{byte(len(k.current))}, k.current...)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out = append(out, nonce...)
+
+	return aead.Seal(out, nonce, plaintext, nil), nil
+}
+
+// open decrypts a message encrypted by seal.
+func (k *Keyring) open(msg []byte) ([]byte, error) {
+	if len(msg) < 1 || len(msg) < 1+int(msg[0]) {
+		return nil, fmt.Errorf("%w: truncated message", ErrDecrypt)
+	}
+	id, msg := string(msg[1:1+int(msg[0])]), msg[1+int(msg[0]):]
+
+	aead, err := k.aead(id)
+	if err != nil {
+		return nil, err
+	}
+	if len(msg) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: truncated message", ErrDecrypt)
+	}
+
+	plaintext, err := aead.Open(nil, msg[:aead.NonceSize()], msg[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecrypt, err)
+	}
+	return plaintext, nil
+}
+
+// Encrypted streams, as written by Dump with a keyring, start with
+// cryptMagic, the length and ID of the key, and a random nonce prefix. The
+// plaintext follows in records of at most cryptChunk bytes, each made of a
+// flag byte telling whether it is the last one, the length of its ciphertext
+// as a big-endian uint32, and the ciphertext. Records are sealed with the
+// nonce prefix and their index, and authenticate their flag, so that
+// reordered, truncated or extended streams fail to decrypt.
+const (
+	cryptMagic  = "EBX1"
+	cryptPrefix = 8
+	cryptChunk  = 64 << 10
+)
+
+// encrypter returns a writer encrypting to w with the current key, or w
+// itself if the keyring is nil. Close must be called to write the last
+// record.
+func (k *Keyring) encrypter(w io.Writer) (io.WriteCloser, error) {
+	if k == nil {
+		return nopWriteCloser{w}, nil
+	}
+
+	aead, err := k.aead(k.current)
+	if err != nil {
+		return nil, err
+	}
+
+	header := append([]byte(cryptMagic), byte(len(k.current)))
+	header = append(header, k.current...)
+	prefix := make([]byte, cryptPrefix)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	header = append(header, prefix...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &encryptWriter{w: w, aead: aead, prefix: prefix}, nil
+}
+
+type encryptWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	prefix []byte
+	index  uint32
+	buf    []byte
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		// a full chunk is only sealed once more data arrives, so that Close
+		// can mark the last one
+		if len(e.buf) == cryptChunk {
+			if err := e.seal(false); err != nil {
+				return n - len(p), err
+			}
+		}
+
+		m := min(len(p), cryptChunk-len(e.buf))
+		e.buf = append(e.buf, p[:m]...)
+		p = p[m:]
+	}
+	return n, nil
+}
+
+func (e *encryptWriter) Close() error {
+	return e.seal(true)
+}
+
+func (e *encryptWriter) seal(last bool) error {
+	flag := []byte{0}
+	if last {
+		flag[0] = 1
+	}
+
+	sealed := e.aead.Seal(nil, cryptNonce(e.aead, e.prefix, e.index), e.buf, flag)
+	record := append(flag, binary.BigEndian.AppendUint32(nil, uint32(len(sealed)))...)
+	if _, err := e.w.Write(append(record, sealed...)); err != nil {
+		return err
+	}
+
+	e.index++
+	e.buf = e.buf[:0]
+	return nil
+}
+
+// cryptNonce returns the nonce of the record at index, made of the stream
+// prefix followed by the index.
+func cryptNonce(aead cipher.AEAD, prefix []byte, index uint32) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[len(nonce)-4:], index)
+	return nonce
+}
+
+// decrypter returns a reader of the plaintext of r if r is an encrypted
+// stream, or of r itself otherwise, buffered so that callers can peek at it.
+func (k *Keyring) decrypter(r io.Reader) (*bufio.Reader, error) {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+
+	if head, _ := br.Peek(len(cryptMagic)); string(head) != cryptMagic {
+		return br, nil
+	}
+	br.Discard(len(cryptMagic))
+
+	n, err := br.ReadByte()
+	if err != nil {
+		return nil, fmt.Errorf("%w: truncated header", ErrDecrypt)
+	}
+	header := make([]byte, int(n)+cryptPrefix)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("%w: truncated header", ErrDecrypt)
+	}
+
+	aead, err := k.aead(string(header[:n]))
+	if err != nil {
+		return nil, err
+	}
+
+	return bufio.NewReader(&decryptReader{r: br, aead: aead, prefix: header[n:]}), nil
+}
+
+type decryptReader struct {
+	r      io.Reader
+	aead   cipher.AEAD
+	prefix []byte
+	index  uint32
+	buf    bytes.Reader
+	done   bool
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for d.buf.Len() == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.next(); err != nil {
+			return 0, err
+		}
+	}
+	return d.buf.Read(p)
+}
+
+// next decrypts the next record into buf.
+func (d *decryptReader) next() error {
+	var head [5]byte
+	if _, err := io.ReadFull(d.r, head[:]); err != nil {
+		// the last record was not reached
+		return fmt.Errorf("%w: truncated stream", ErrDecrypt)
+	}
+
+	sealed := make([]byte, binary.BigEndian.Uint32(head[1:]))
+	if len(sealed) > cryptChunk+d.aead.Overhead() {
+		return fmt.Errorf("%w: invalid record", ErrDecrypt)
+	}
+	if _, err := io.ReadFull(d.r, sealed); err != nil {
+		return fmt.Errorf("%w: truncated stream", ErrDecrypt)
+	}
+
+	plaintext, err := d.aead.Open(nil, cryptNonce(d.aead, d.prefix, d.index), sealed, head[:1])
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDecrypt, err)
+	}
+
+	d.index++
+	d.done = head[0] == 1
+	d.buf.Reset(plaintext)
+
+	if d.done {
+		// nothing may follow the last record
+		var extra [1]byte
+		if _, err := io.ReadFull(d.r, extra[:]); err == nil {
+			return fmt.Errorf("%w: trailing data", ErrDecrypt)
+		} else if err != io.EOF {
+			return err
+		}
+	}
+	return nil
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,116 @@
+package eventbus
+
+import (
+	"encoding/base64"
+	"strconv"
+)
+
+// CheckCursor returns ErrUnknownCursor if id cannot be used as Query.AfterID
+// or fromID, because it refers to no event of the log, not even to one that
+// has since been removed by retention or TruncateBefore. This typically
+// happens with a cursor saved against another log, for instance before the
+// log was rebuilt or merged. The empty string is always a valid cursor.
+//
+// ForEachEvent and the other queries return no events for an unknown
+// cursor, and subscriptions return ErrUnknownCursor.
+func (b *Bus) CheckCursor(id string) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if _, ok, _ := b.start(id); !ok {
+		return ErrUnknownCursor
+	}
+
+	return nil
+}
+
+// ResolveNearestCursor returns the cursor to use instead of id, so that
+// consumers holding an unknown cursor can recover deliberately rather than
+// read nothing. A valid id is returned as is. Otherwise, it returns the ID
+// of the last event whose ID sorts before id, or Start if there is none, so
+// that reading from it delivers every event after id.
+//
+// It returns ErrUnknownCursor if id is not an event ID at all.
+func (b *Bus) ResolveNearestCursor(id string) (string, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if _, ok, _ := b.start(id); ok {
+		return id, nil
+	}
+
+	seq, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return "", ErrUnknownCursor
+	}
+
+	if i := searchAfter(b.events, seq); i > 0 {
+		return b.events[i-1].ID, nil
+	}
+
+	if b.truncatedSeq == 0 {
+		return "", nil
+	}
+	return strconv.FormatUint(b.truncatedSeq, 10), nil
+}
+
+// QueryPage returns a page of the events matching q, of at most q.Limit
+// events, and the cursor of the next page, which is empty after the last
+// one. Pass the empty string as cursor for the first page, then the cursor
+// returned by the previous call with the same q.
+//
+// Cursors are opaque strings, safe to put in URLs. Unlike q.Offset, which
+// only applies to the first page, they point to the last event of the page,
+// so that events appended between calls do not shift pages: with q.Reverse,
+// new events are left out, and otherwise they come on the last pages.
+//
+// If the event a cursor points to was removed by retention or
+// TruncateBefore meanwhile, the next page starts with the first event
+// retained after it, as with subscriptions. It returns ErrUnknownCursor if
+// cursor was not returned by QueryPage, or points to an event the log never
+// held, such as one from another log.
+func (b *Bus) QueryPage(q Query, cursor string) ([]Event, string, error) {
+	var id string
+	if cursor != "" {
+		data, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil || len(data) < 2 || data[0] != 'a' && data[0] != 'b' {
+			return nil, "", ErrUnknownCursor
+		}
+
+		if id = string(data[1:]); data[0] == 'b' {
+			q.BeforeID = id
+		} else {
+			q.AfterID = id
+		}
+		q.Offset = 0
+	}
+
+	if q.Limit > 0 {
+		// read one more event to know if there is a next page
+		q.Limit++
+	}
+
+	b.mu.RLock()
+	if _, ok, _ := b.start(id); !ok {
+		b.mu.RUnlock()
+		return nil, "", ErrUnknownCursor
+	}
+	events := b.filter(q)
+	b.mu.RUnlock()
+
+	if q.Limit <= 0 {
+		return events, "", nil
+	}
+
+	if len(events) < q.Limit {
+		return events, "", nil
+	}
+
+	events = events[:len(events)-1]
+	dir := "a"
+	if q.Reverse {
+		dir = "b"
+	}
+
+	return events, base64.RawURLEncoding.EncodeToString([]byte(dir + events[len(events)-1].ID)), nil
+}
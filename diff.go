@@ -0,0 +1,154 @@
+package eventbus
+
+import (
+	"encoding/json"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+)
+
+// Change is a field that differs between two payloads.
+type Change struct {
+	// Path locates the field, with object keys separated by dots and array
+	// indexes in brackets, such as "address.city" or "items[2].qty". It is
+	// empty when the payloads themselves are scalars.
+	Path string `json:"path"`
+
+	// Old and New are the JSON values of the field, nil when the field is
+	// absent on that side.
+	Old any `json:"old"`
+	New any `json:"new"`
+}
+
+// ChangesType is the event type of the events published by PublishChanges.
+const ChangesType = "fields_changed"
+
+// Changes is the payload of the events published by PublishChanges.
+type Changes struct {
+	Topic   string   `json:"topic"`
+	EventID string   `json:"event_id"`
+	Changes []Change `json:"changes"`
+}
+
+// Diff compares two payloads as they would be encoded in JSON, and returns
+// the fields that differ, sorted by path. Objects and arrays are compared
+// field by field; anything else is compared as a whole.
+func Diff(old, new any) ([]Change, error) {
+	o, err := normalize(old)
+	if err != nil {
+		return nil, err
+	}
+	n, err := normalize(new)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := n.(map[string]any); ok && o == nil {
+		// compare a first state field by field
+		o = map[string]any{}
+	}
+
+	var changes []Change
+	diff("", o, n, &changes)
+
+	return changes, nil
+}
+
+// normalize turns v into the generic value it decodes to in JSON.
+func normalize(v any) (any, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var out any
+	err = json.Unmarshal(data, &out)
+	return out, err
+}
+
+func diff(path string, old, new any, changes *[]Change) {
+	switch o := old.(type) {
+	case map[string]any:
+		if n, ok := new.(map[string]any); ok {
+			keys := slices.Collect(maps.Keys(o))
+			for k := range n {
+				if _, ok := o[k]; !ok {
+					keys = append(keys, k)
+				}
+			}
+			slices.Sort(keys)
+
+			for _, k := range keys {
+				p := k
+				if path != "" {
+					p = path + "." + k
+				}
+				diff(p, o[k], n[k], changes)
+			}
+			return
+		}
+
+	case []any:
+		if n, ok := new.([]any); ok {
+			for i := range max(len(o), len(n)) {
+				var ov, nv any
+				if i < len(o) {
+					ov = o[i]
+				}
+				if i < len(n) {
+					nv = n[i]
+				}
+				diff(path+"["+strconv.Itoa(i)+"]", ov, nv, changes)
+			}
+			return
+		}
+	}
+
+	if !reflect.DeepEqual(old, new) {
+		*changes = append(*changes, Change{Path: path, Old: old, New: new})
+	}
+}
+
+// PublishChanges starts a handler named name that compares the payload of
+// each event matching q with the payload of the previous event of the same
+// topic, and publishes the fields that changed to topic as a Changes event.
+//
+// It is meant for latest-state topics, where each event carries the whole
+// state of something, to feed change logs and audit displays. The first
+// event of each topic is compared with an empty payload, and events that
+// change nothing publish nothing. q must not select topic itself.
+func (b *Bus) PublishChanges(name string, q Query, topic string, opts ...HandlerOption) (*Handler, error) {
+	if topic == "" {
+		return nil, ErrNoTopic
+	}
+
+	last := make(map[string]any)
+
+	return b.Handle(name, q, func(e Event) error {
+		changes, err := Diff(last[e.Topic], e.Payload)
+		if err != nil {
+			return err
+		}
+		last[e.Topic] = e.Payload
+
+		if len(changes) == 0 {
+			return nil
+		}
+
+		_, err = b.publishUnchecked(Event{
+			Topic: topic,
+			Type:  ChangesType,
+			Payload: Changes{
+				Topic:   e.Topic,
+				EventID: e.ID,
+				Changes: changes,
+			},
+		})
+		return err
+	}, opts...)
+}
@@ -0,0 +1,107 @@
+package eventbus
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+)
+
+// Workers consumes sub with n workers calling fn concurrently, each taking
+// the next event as soon as it is free, so events are processed out of
+// order. Use Dispatch to keep some of them in order.
+//
+// Workers returns once sub is closed and every worker is done, with the
+// errors returned by fn, and the panics it raised, joined together, each
+// with the ID of its event. An error does not stop the workers. n less than
+// 1 means a single worker.
+func Workers(sub *Subscription, n int, fn func(Event) error) error {
+	p := newPool(1, fn)
+	for range max(n, 1) {
+		p.start(p.queues[0])
+	}
+
+	for e := range sub.C {
+		p.queues[0] <- e
+	}
+
+	return p.wait()
+}
+
+// Dispatch consumes sub with n workers calling fn concurrently, while
+// keeping the events that share a key, as returned by key, in order: they
+// all go to the same worker, so that a projection can scale across
+// aggregates without breaking the ordering within each of them.
+//
+// Dispatch returns once sub is closed and every worker is done, with the
+// errors returned by fn, and the panics it raised, joined together, each
+// with the ID of its event. An error does not stop the dispatch. n less
+// than 1 means a single worker.
+func Dispatch(sub *Subscription, n int, key func(Event) string, fn func(Event) error) error {
+	p := newPool(max(n, 1), fn)
+	for _, queue := range p.queues {
+		p.start(queue)
+	}
+
+	for e := range sub.C {
+		h := fnv.New32a()
+		h.Write([]byte(key(e)))
+		p.queues[h.Sum32()%uint32(len(p.queues))] <- e
+	}
+
+	return p.wait()
+}
+
+// pool runs workers calling fn for the events of their queue.
+type pool struct {
+	fn     func(Event) error
+	queues []chan Event
+	wg     sync.WaitGroup
+
+	mu   sync.Mutex
+	errs []error
+}
+
+func newPool(queues int, fn func(Event) error) *pool {
+	p := &pool{fn: fn, queues: make([]chan Event, queues)}
+	for i := range p.queues {
+		p.queues[i] = make(chan Event, 64)
+	}
+	return p
+}
+
+// start starts a worker for queue.
+func (p *pool) start(queue <-chan Event) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		for e := range queue {
+			if err := p.call(e); err != nil {
+				p.mu.Lock()
+				p.errs = append(p.errs, fmt.Errorf("event %s: %w", e.ID, err))
+				p.mu.Unlock()
+			}
+		}
+	}()
+}
+
+// call runs fn and turns a panic into an error.
+func (p *pool) call(e Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("eventbus: worker panic: %v", r)
+		}
+	}()
+
+	return p.fn(e)
+}
+
+// wait closes the queues, waits for the workers and returns their errors.
+func (p *pool) wait() error {
+	for _, queue := range p.queues {
+		close(queue)
+	}
+	p.wg.Wait()
+
+	return errors.Join(p.errs...)
+}
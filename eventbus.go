@@ -1,12 +1,24 @@
 package eventbus
 
 import (
+	"bytes"
+	"cmp"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"iter"
+	"maps"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -22,6 +34,52 @@ var (
 
 	// ErrInvalidBuffer is returned when a negative buffer size is provided.
 	ErrInvalidBuffer = errors.New("eventbus: invalid buffer size")
+
+	// ErrClosed is returned when you publish or subscribe on a closed bus.
+	ErrClosed = errors.New("eventbus: bus closed")
+
+	// ErrFrozen is returned when you append to a bus frozen with Freeze.
+	ErrFrozen = errors.New("eventbus: bus frozen")
+
+	// ErrNotFound is returned when an event ID does not exist in the log.
+	ErrNotFound = errors.New("eventbus: event not found")
+
+	// ErrNoNamespace is returned when a Router cannot find the namespace of a
+	// topic.
+	ErrNoNamespace = errors.New("eventbus: namespace required")
+
+	// ErrUnsupportedFormat is returned when Load reads a dump written in a
+	// newer, incompatible format.
+	ErrUnsupportedFormat = errors.New("eventbus: unsupported dump format")
+
+	// ErrTxDone is returned when you commit a transaction that has already
+	// been committed or rolled back.
+	ErrTxDone = errors.New("eventbus: transaction done")
+
+	// ErrInvalidPayload is returned when you publish an event that does not
+	// match the schema of a topic in SchemaOnWrite mode.
+	ErrInvalidPayload = errors.New("eventbus: invalid payload")
+
+	// ErrUnknownCursor is returned when you subscribe after an event ID that
+	// does not exist in the log. See CheckCursor and ResolveNearestCursor.
+	ErrUnknownCursor = errors.New("eventbus: unknown cursor")
+
+	// ErrVetoed is returned when a pre-commit listener rejects an event
+	// being published. See PreCommit.
+	ErrVetoed = errors.New("eventbus: event vetoed")
+
+	// ErrInvalidExpr is returned when a filter expression passed to
+	// CompileExpr cannot be parsed.
+	ErrInvalidExpr = errors.New("eventbus: invalid expression")
+
+	// ErrDecrypt is returned when encrypted data cannot be decrypted, because
+	// its key is missing from the keyring or it was altered.
+	ErrDecrypt = errors.New("eventbus: cannot decrypt")
+
+	// ErrHasStore is returned when you load events into a bus created with
+	// NewWithStore, whose store already holds the IDs the loaded log would
+	// reuse.
+	ErrHasStore = errors.New("eventbus: bus has a store")
 )
 
 // Event is the unit that gets stored and published.
@@ -38,10 +96,24 @@ type Event struct {
 	// for routing and deserialization decisions.
 	Type string `json:"type"`
 
+	// Version is the position of the event within its topic, starting at 1.
+	// It is zero for events published with PublishUnstored.
+	Version int `json:"version,omitempty"`
+
 	// Payload holds the event data.
 	// It is typically a concrete, JSON-serializable struct value that callers
 	// type-assert when consuming events.
 	Payload any `json:"payload"`
+
+	// ExpiresAt is the time after which the event is no longer returned by
+	// queries or replayed to subscribers. A zero value means the event never
+	// expires. Expired events stay in the log until Sweep purges them.
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
+// expired reports whether e has expired at now.
+func (e Event) expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && !now.Before(e.ExpiresAt)
 }
 
 // Subscription exposes an events channel plus a Close function to stop delivery.
@@ -51,27 +123,310 @@ type Event struct {
 type Subscription struct {
 	C     <-chan Event
 	Close func()
+
+	// Trimmed reports whether history the subscriber asked for is gone: the
+	// fromID passed to Subscribe referred to an event that has since been
+	// removed by retention or TruncateBefore, or fromID was empty and some
+	// events were removed. Replay then starts at the oldest retained event,
+	// and the subscriber may have missed events in between.
+	Trimmed bool
+
+	bus *Bus
+	sub *subscriber
+}
+
+// ID returns the identifier of the subscription within the bus, as found in
+// topic traces.
+func (s *Subscription) ID() uint64 {
+	return s.sub.id
+}
+
+// Name returns the name of the subscription given with WithName.
+func (s *Subscription) Name() string {
+	return s.sub.name
+}
+
+// Dropped returns the number of events dropped for this subscription because
+// its channel buffer was full.
+func (s *Subscription) Dropped() uint64 {
+	return s.sub.dropped.Load()
+}
+
+// Events returns an iterator over the events of the subscription, which
+// ends when ctx is done or the subscription is closed:
+//
+//	for e := range sub.Events(ctx) {
+//		...
+//	}
+//
+// The subscription is closed when the loop ends, including on break, so it
+// must not be used afterwards.
+func (s *Subscription) Events(ctx context.Context) iter.Seq[Event] {
+	return func(yield func(Event) bool) {
+		defer s.Close()
+
+		for {
+			select {
+			case e, ok := <-s.C:
+				if !ok || !yield(e) {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// Pause stops the delivery of live events to the subscription, without
+// losing its position, for instance while the view it feeds is hidden.
+func (s *Subscription) Pause() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	s.sub.paused = true
+}
+
+// Resume restarts the delivery of events after Pause, starting with the
+// stored events the subscription missed in the meantime, in log order.
+// Events published with PublishUnstored while paused are lost. Members of a
+// consumer group do not catch up, as the rest of the group took over their
+// events.
+func (s *Subscription) Resume() {
+	b := s.bus
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := s.sub
+	if _, ok := b.subscribers[sub]; !ok || !sub.paused {
+		return
+	}
+	sub.paused = false
+
+	if sub.group != "" || sub.pumping {
+		return
+	}
+	if start, ok, trimmed := b.start(sub.lastID); ok {
+		sub.trimmed(trimmed)
+		if _, full := b.catchUp(sub, start); full {
+			go b.pump(sub)
+		}
+	}
+}
+
+// SubscribeOption configures a subscription.
+type SubscribeOption func(*subscriber)
+
+// WithName labels the subscription, so that it can be told apart in
+// diagnostics: SubscriberLags, topic traces and PublishSync deliveries.
+// Handlers and sinks name their subscriptions after themselves.
+func WithName(name string) SubscribeOption {
+	return func(s *subscriber) {
+		s.name = name
+	}
+}
+
+// WithBufferSize sets the buffer size of the subscription channel, like
+// SubscribeWithBufferSize does.
+func WithBufferSize(n int) SubscribeOption {
+	return func(s *subscriber) {
+		s.bufferSize = n
+	}
+}
+
+// WithTopicRegexp restricts the subscription to the topics matching re, in
+// addition to the topic it was created with. Subscribe to AllTopics to select
+// topics with re alone.
+func WithTopicRegexp(re *regexp.Regexp) SubscribeOption {
+	return func(s *subscriber) {
+		s.query.TopicRegexp = re
+	}
+}
+
+// WithOnDrop registers fn to be called with each event dropped for the
+// subscription because its channel buffer was full.
+//
+// fn is called synchronously while the bus lock is held, in log order, so it
+// must be fast and must not call back into the bus. To re-replay after a gap,
+// signal another goroutine that resubscribes from the last event received.
+func WithOnDrop(fn func(Event)) SubscribeOption {
+	return func(s *subscriber) {
+		s.onDrop = fn
+	}
+}
+
+// WithShutdownPriority sets the order in which Shutdown closes the
+// subscription: subscriptions with a lower priority are closed and drained
+// first, so consumers that must flush, such as an audit sink, should get a
+// higher one than UI streams. The default priority is 0.
+func WithShutdownPriority(p int) SubscribeOption {
+	return func(s *subscriber) {
+		s.priority = p
+	}
 }
 
 type subscriber struct {
-	topic string
-	ch    chan Event
+	id         uint64
+	name       string
+	query      Query
+	bufferSize int
+	ch         chan Event
+	dropped    atomic.Uint64
+	onDrop     func(Event)
+	group      string
+	ack        *acker
+
+	// priority orders the subscriber during Shutdown, and finished, if not
+	// nil, is closed once its consumer is done with the closed channel.
+	priority int
+	finished <-chan struct{}
+
+	// lastID is the ID of the last stored event sent to the subscriber, or
+	// the position it started from, and paused stops live delivery.
+	lastID string
+	paused bool
+
+	// pumping is set while the subscriber catches up with history that did
+	// not fit in its buffer, see Bus.pump, and quit stops the pump.
+	pumping bool
+	quit    chan struct{}
+
+	limit     *limiter
+	coalesce  func(Event) string
+	parkAfter int
+
+	// giveUp makes the relay of a coalescing subscriber drop its pending
+	// events rather than wait for the consumer, see coalesced.
+	giveUp     chan struct{}
+	giveUpOnce sync.Once
+
+	// topics maps the topics of a TopicSet to their cursor, and is nil for
+	// other subscribers.
+	topics map[string]uint64
+
+	// onStatus receives lifecycle notifications, err is why the subscriber
+	// closed, and trimmedAt is the position trimming was last reported at.
+	onStatus  func(Status)
+	err       error
+	trimmedAt *string
+
+	// delivered is the sequence number of the last stored event that entered
+	// the channel, and progress, if not nil, is closed when it moves or the
+	// subscriber stops pumping or closes, to wake up PublishSync.
+	delivered uint64
+	progress  chan struct{}
+}
+
+// deliver sends e to the subscriber without blocking, and reports whether it
+// was sent. It must be called with the bus lock held, which keeps deliveries
+// in log order.
+func (s *subscriber) deliver(e Event) bool {
+	select {
+	case s.ch <- e:
+		s.sent(e)
+		return true
+	default:
+		// buffer full: drop for this subscriber
+		s.drop(e)
+		return false
+	}
+}
+
+// sent records that e was sent to the subscriber, so that it waits for
+// acknowledgement if the subscriber requires one.
+func (s *subscriber) sent(e Event) {
+	s.advance(e)
+	s.acked(e)
+	s.entered(e)
+}
+
+// entered records that e is in the channel of the subscriber.
+func (s *subscriber) entered(e Event) {
+	if e.ID != "" {
+		s.delivered = max(s.delivered, seqOf(e.ID))
+	}
+	s.wake()
+}
+
+// wake wakes up whoever waits on the progress of the subscriber.
+func (s *subscriber) wake() {
+	if s.progress != nil {
+		close(s.progress)
+		s.progress = nil
+	}
+}
+
+// advance moves the position of the subscriber past e.
+func (s *subscriber) advance(e Event) {
+	if e.ID != "" {
+		s.lastID = e.ID
+		if _, ok := s.topics[e.Topic]; ok {
+			s.topics[e.Topic] = seqOf(e.ID)
+		}
+	}
+}
+
+// acked makes e wait for acknowledgement if the subscriber requires one.
+func (s *subscriber) acked(e Event) {
+	if s.ack != nil {
+		s.ack.track(e, time.Now().Add(s.ack.timeout))
+	}
+}
+
+// drop counts e as dropped for the subscriber and reports it to onDrop.
+// Subscribers requiring acknowledgement get it again as soon as possible.
+func (s *subscriber) drop(e Event) {
+	if s.ack != nil {
+		s.ack.track(e, time.Time{})
+	}
+	s.dropped.Add(1)
+	if s.onDrop != nil {
+		s.onDrop(e)
+	}
+	s.notify(Status{Kind: StatusDropped, Event: e})
 }
 
 // Query configures how events are selected when reading from the log.
 //
 // Zero values disable their corresponding filters: an empty Topic (or
-// AllTopics) selects all topics, an empty Type selects all types, and a zero
-// time for Since or Until disables that time bound.
+// AllTopics) and no Topics selects all topics, an empty Type and no Types
+// selects all types, and a zero time for Since or Until disables that time
+// bound.
 type Query struct {
 	// Topic restricts the query to events with this topic.
 	// An empty value or AllTopics selects all topics.
+	//
+	// Topic can also be a pattern where each * matches any sequence of
+	// characters, such as "account:*" or "orders.eu.*". As a consequence,
+	// topics containing * cannot be selected literally.
 	Topic string
 
+	// Topics restricts the query to events whose topic is any of these, each
+	// of which can be a pattern as well. It is combined with Topic: an event
+	// matches if its topic matches Topic or one of Topics. An empty slice adds
+	// no topic.
+	Topics []string
+
+	// TopicRegexp restricts the query to events whose topic matches this
+	// regular expression, in addition to Topic and Topics. It covers the
+	// cases patterns cannot express, such as topics embedding a tenant ID.
+	// A nil value disables regular expression matching.
+	TopicRegexp *regexp.Regexp
+
+	// TopicPrefix restricts the query to events whose topic starts with this
+	// prefix, in addition to Topic and Topics, such as "account:" for every
+	// account. Unlike patterns, it matches topics containing * literally. An
+	// empty value disables prefix matching.
+	TopicPrefix string
+
 	// Type restricts the query to events with this type.
 	// An empty value selects all types.
 	Type string
 
+	// Types restricts the query to events whose type is any of these.
+	// It is combined with Type the same way Topics is combined with Topic.
+	Types []string
+
 	// Since selects events whose timestamp is strictly after this time.
 	// A zero value disables the lower time bound.
 	Since time.Time
@@ -81,84 +436,395 @@ type Query struct {
 	Until time.Time
 
 	// AfterID selects events strictly after the event with the given ID.
-	// If no event with that ID exists, no events are returned.
+	// If no event with that ID exists, no events are returned, and
+	// subscriptions return ErrUnknownCursor.
 	AfterID string
 
+	// BeforeID selects events strictly before the event with the given ID,
+	// so that with AfterID, a query reads a bounded window of the log, such
+	// as a page of a replication or an audit export. As IDs are ordered, the
+	// event does not need to be in the log anymore. An empty value disables
+	// the bound. It applies to ForEachEvent, not to subscriptions.
+	BeforeID string
+
 	// PayloadFilter selects events whose payload satisfies the predicate.
-	// A nil value disables payload filtering.
+	// A nil value disables payload filtering. Where adds declarative field
+	// filters to it.
 	PayloadFilter func(any) bool
+
+	// Expr selects events for which the compiled expression holds, so that
+	// filters can be written as strings. A nil value disables it.
+	Expr *Expr
+
+	// Offset skips this many matching events, and Limit caps the number of
+	// events returned, so that large logs can be paged through. A zero Limit
+	// returns every event. They apply to ForEachEvent, not to subscriptions.
+	Offset int
+	Limit  int
+
+	// Reverse returns events newest first, so that with Limit, a query
+	// returns the latest events, such as the last 20 of an account. Offset
+	// then skips the newest ones. It applies to ForEachEvent, not to
+	// subscriptions.
+	Reverse bool
 }
 
 // Bus is an in-memory pub/sub bus with an append-only event log.
 type Bus struct {
-	mu          sync.Mutex
+	mu          sync.RWMutex
 	events      []Event
 	indexByID   map[string]int
 	subscribers map[*subscriber]struct{}
+	groups      map[string]*group
+
+	// indexByTopic holds the positions of the events of each topic, in log
+	// order, so that reads of a single topic do not scan the whole log.
+	indexByTopic map[string][]int
+
+	// unordered is true if the timestamps of the log are not in ascending
+	// order, such as after publishing events with a past timestamp, which
+	// rules out binary search on Query.Since and Query.Until.
+	unordered bool
+
+	// subSeq is the ID of the last subscriber.
+	subSeq uint64
+
+	// seq is the sequence number of the last assigned ID. It keeps growing
+	// even when retention removes events from the end of a topic.
+	seq uint64
+
+	// trimmedSeq is the highest sequence number removed by retention.
+	trimmedSeq uint64
+
+	// truncatedSeq is the sequence number up to which every event has been
+	// removed, by TruncateBefore or because a loaded log started later.
+	truncatedSeq uint64
+
+	retention map[string]Retention
+	schemas   map[string]Schema
+	traces    map[string]*topicTrace
+	warned    map[string]bool
+	sweeper   chan struct{}
+	autosave  chan struct{}
+	closed    bool
+	frozen    bool
+
+	schedule schedule
+	timer    *time.Timer
+
+	// holdUntil delays the scheduler after the store refused a due event.
+	holdUntil time.Time
+
+	handlers map[*Handler]struct{}
+
+	recorder *recorder
+
+	precommits []*precommit
+
+	// store keeps the log outside of memory, if not nil. See NewWithStore.
+	store Store
+
+	// keyring encrypts dumps, if not nil. See SetKeyring.
+	keyring *Keyring
+
+	// versions holds the version of the last event of each topic. It is not
+	// affected by retention.
+	versions map[string]int
 }
 
 // New creates a Bus with an empty event log.
 func New() *Bus {
 	return &Bus{
-		events:      make([]Event, 0),
-		indexByID:   make(map[string]int),
-		subscribers: make(map[*subscriber]struct{}),
+		events:       make([]Event, 0),
+		indexByID:    make(map[string]int),
+		indexByTopic: make(map[string][]int),
+		subscribers:  make(map[*subscriber]struct{}),
+		groups:       make(map[string]*group),
+		retention:    make(map[string]Retention),
+		schemas:      make(map[string]Schema),
+		traces:       make(map[string]*topicTrace),
+		warned:       make(map[string]bool),
+		handlers:     make(map[*Handler]struct{}),
+		versions:     make(map[string]int),
 	}
 }
 
-// yieldID generates a new ID for the next event.
+// yieldID generates the ID of the i-th next event, 0 being the next one.
 // IDs look sequential for debuggability, but the values themselves are opaque
 // and could be replaced by any other unique identifier scheme.
-func (b *Bus) yieldID() string {
-	if len(b.events) == 0 {
-		return "1"
+func (b *Bus) yieldID(i int) string {
+	return strconv.FormatUint(b.seq+uint64(i)+1, 10)
+}
+
+// start returns the position of the first event strictly after id.
+//
+// ok is false when id is unknown. trimmed is true when events after id may
+// have been removed: either id itself was removed, in which case start points
+// at the first retained event that comes after it, or id is empty and some
+// history is gone.
+func (b *Bus) start(id string) (start int, ok bool, trimmed bool) {
+	if id == "" {
+		return 0, true, b.trimmedSeq > 0
 	}
 
-	v, err := strconv.ParseUint(b.events[len(b.events)-1].ID, 10, 64)
-	if err != nil {
-		panic("eventbus: invalid id")
+	if idx, found := b.indexByID[id]; found {
+		return idx + 1, true, false
+	}
+
+	seq, err := strconv.ParseUint(id, 10, 64)
+	if err != nil || seq > b.trimmedSeq {
+		return 0, false, false
+	}
+
+	return searchAfter(b.events, seq), true, true
+}
+
+// bound returns the position of the first event at or after the event with
+// the given ID, or the length of the log if id is empty, so that the events
+// before it are those selected by Query.BeforeID. An unknown ID that is not a
+// sequence number bounds the log to no events.
+func (b *Bus) bound(id string) int {
+	if id == "" {
+		return len(b.events)
+	}
+
+	if idx, found := b.indexByID[id]; found {
+		return idx
 	}
 
-	return strconv.FormatUint(v+1, 10)
+	seq, err := strconv.ParseUint(id, 10, 64)
+	if err != nil || seq == 0 {
+		return 0
+	}
+
+	return searchAfter(b.events, seq-1)
+}
+
+// searchAfter returns the position of the first event whose ID is greater
+// than seq, relying on events being sorted by ID.
+func searchAfter(events []Event, seq uint64) int {
+	return sort.Search(len(events), func(i int) bool {
+		v, _ := strconv.ParseUint(events[i].ID, 10, 64)
+		return v > seq
+	})
 }
 
 func (b *Bus) filter(q Query) []Event {
-	start := 0
-	if q.AfterID != "" {
-		idx, ok := b.indexByID[q.AfterID]
-		if !ok {
-			// unknown AfterID: treat as no results
-			return nil
-		}
-		start = idx + 1
+	start, ok, _ := b.start(q.AfterID)
+	if !ok {
+		// unknown AfterID: treat as no results
+		return nil
 	}
 
-	events := make([]Event, 0, len(b.events)-start)
-	for i := start; i < len(b.events); i++ {
+	var events []Event
+	now := time.Now()
+	skip := q.Offset
+	for i := range b.positions(q, start, b.bound(q.BeforeID), q.Reverse) {
 		e := b.events[i]
-		if q.Topic != "" && q.Topic != AllTopics && e.Topic != q.Topic {
+		if e.expired(now) || !q.match(e) {
 			continue
 		}
-		if q.Type != "" && e.Type != q.Type {
+		if skip > 0 {
+			skip--
 			continue
 		}
-		if q.PayloadFilter != nil && !q.PayloadFilter(e.Payload) {
-			continue
+
+		events = append(events, e)
+		if len(events) == q.Limit {
+			break
 		}
-		if !q.Since.IsZero() && !e.Timestamp.After(q.Since) {
-			continue
+	}
+
+	return events
+}
+
+// scan calls fn with each event from position start to end that matches q,
+// without copying the log. Expired events are skipped. It must be called with
+// b.mu held.
+func (b *Bus) scan(start, end int, q Query, fn func(Event)) {
+	now := time.Now()
+	for i := range b.positions(q, start, end, false) {
+		if e := b.events[i]; !e.expired(now) && q.match(e) {
+			fn(e)
 		}
-		if !q.Until.IsZero() && !e.Timestamp.Before(q.Until) {
-			continue
+	}
+}
+
+// positions returns an iterator over the log positions from start to end
+// that can hold events matching q, newest first if reverse is true. If q
+// selects a single topic by name, only the positions of that topic are
+// visited. It must be called with b.mu held.
+func (b *Bus) positions(q Query, start, end int, reverse bool) iter.Seq[int] {
+	return func(yield func(int) bool) {
+		start, end := b.window(q, start, end)
+		at := func(i int) int { return i }
+		lo, hi := start, end
+		if topic, ok := q.single(); ok {
+			idx := b.indexByTopic[topic]
+			at = func(i int) int { return idx[i] }
+			lo, hi = sort.SearchInts(idx, start), sort.SearchInts(idx, end)
+		}
+
+		for i := range max(hi-lo, 0) {
+			j := lo + i
+			if reverse {
+				j = hi - 1 - i
+			}
+			if !yield(at(j)) {
+				return
+			}
 		}
-		events = append(events, e)
 	}
+}
 
-	return events
+// window narrows the log positions from start to end to those of the events
+// that can fall between q.Since and q.Until, by binary search, unless the log
+// is not in timestamp order. It must be called with b.mu held.
+func (b *Bus) window(q Query, start, end int) (int, int) {
+	if b.unordered {
+		return start, end
+	}
+
+	if !q.Since.IsZero() {
+		start = max(start, sort.Search(len(b.events), func(i int) bool {
+			return b.events[i].Timestamp.After(q.Since)
+		}))
+	}
+	if !q.Until.IsZero() {
+		end = min(end, sort.Search(len(b.events), func(i int) bool {
+			return !b.events[i].Timestamp.Before(q.Until)
+		}))
+	}
+
+	return start, end
+}
+
+// single returns the topic selected by q if it is a single topic named
+// without pattern.
+func (q Query) single() (string, bool) {
+	if q.Topic == "" || strings.Contains(q.Topic, "*") || len(q.Topics) > 0 {
+		return "", false
+	}
+	return q.Topic, true
+}
+
+// advanced reports whether topic has events after lastID. Unlike queries, it
+// also considers expired events, as they are still part of the log.
+// It must be called with b.mu held.
+func (b *Bus) advanced(topic, lastID string) bool {
+	start, ok, _ := b.start(lastID)
+	if !ok {
+		return false
+	}
+
+	idx := b.indexByTopic[topic]
+	return len(idx) > 0 && idx[len(idx)-1] >= start
+}
+
+// index returns the position of the i-th event to read in the log positions
+// from start to end, depending on the order of q.
+func (q Query) index(start, end, i int) int {
+	if q.Reverse {
+		return end - 1 - i
+	}
+	return start + i
+}
+
+// Match reports whether e satisfies the filters of q that apply to a single
+// event, that is every filter except AfterID, BeforeID, Offset, Limit and
+// Reverse, which depend on the position of e in the log. It lets a Store that
+// reads events from elsewhere check them against a query.
+func (q Query) Match(e Event) bool {
+	return q.match(e)
+}
+
+// match reports whether e satisfies every filter of q except AfterID and
+// BeforeID, which depend on the position of e in the log.
+func (q Query) match(e Event) bool {
+	if q.Topic != AllTopics && !matchAny(q.Topic, q.Topics, e.Topic, matchTopic) {
+		return false
+	}
+	if q.TopicRegexp != nil && !q.TopicRegexp.MatchString(e.Topic) {
+		return false
+	}
+	if !strings.HasPrefix(e.Topic, q.TopicPrefix) {
+		return false
+	}
+	if !matchAny(q.Type, q.Types, e.Type, func(a, b string) bool { return a == b }) {
+		return false
+	}
+	if q.PayloadFilter != nil && !q.PayloadFilter(e.Payload) {
+		return false
+	}
+	if q.Expr != nil && !q.Expr.Match(e) {
+		return false
+	}
+	if !q.Since.IsZero() && !e.Timestamp.After(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !e.Timestamp.Before(q.Until) {
+		return false
+	}
+	return true
+}
+
+// matchAny reports whether v matches one or any of values according to eq.
+// An empty one together with no values matches everything.
+func matchAny(one string, values []string, v string, eq func(want, v string) bool) bool {
+	if one == "" && len(values) == 0 {
+		return true
+	}
+	if one != "" && eq(one, v) {
+		return true
+	}
+	return slices.ContainsFunc(values, func(want string) bool {
+		return eq(want, v)
+	})
+}
+
+// matchTopic reports whether topic matches pattern, where each * matches any
+// sequence of characters, including none.
+func matchTopic(pattern, topic string) bool {
+	first, rest, wildcard := strings.Cut(pattern, "*")
+	if !wildcard {
+		return pattern == topic
+	}
+
+	topic, ok := strings.CutPrefix(topic, first)
+	if !ok {
+		return false
+	}
+
+	parts := strings.Split(rest, "*")
+	last := parts[len(parts)-1]
+	for _, part := range parts[:len(parts)-1] {
+		i := strings.Index(topic, part)
+		if i < 0 {
+			return false
+		}
+		topic = topic[i+len(part):]
+	}
+
+	return strings.HasSuffix(topic, last)
+}
+
+// Get returns the event with the given ID, and false if it is not in the
+// log, because it never was or was removed since. Expired events are
+// returned until they are swept.
+func (b *Bus) Get(id string) (Event, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	e := b.lookup(id)
+	if e == nil {
+		return Event{}, false
+	}
+
+	return *e, true
 }
 
-// lookup searches by ID starting from the end because
-// recent events are more likely to be referenced.
+// lookup returns the event with the given ID in constant time, using
+// indexByID, or nil if there is none. It must be called with b.mu held.
 func (b *Bus) lookup(id string) *Event {
 	if id == "" {
 		return nil
@@ -179,88 +845,325 @@ func (b *Bus) lookup(id string) *Event {
 // The set of matching events is determined at the time of the call; new events
 // appended after ForEachEvent begins are not passed to fn.
 func (b *Bus) ForEachEvent(q Query, fn func(Event)) {
-	b.mu.Lock()
+	b.mu.RLock()
 	events := b.filter(q)
-	b.mu.Unlock()
+	b.mu.RUnlock()
 
 	for _, e := range events {
 		fn(e)
 	}
 }
 
+// eventsChunk is the number of events Events reads at once.
+const eventsChunk = 256
+
+// Events returns an iterator over the events that match q, like
+// ForEachEvent, but reads them lazily, a chunk at a time, so that breaking
+// out of the loop early does not pay for the rest of the log:
+//
+//	for e := range bus.Events(q) {
+//		...
+//	}
+//
+// Events appended after Events is called are not returned. The bus is not
+// locked while the loop body runs, so it can publish.
+func (b *Bus) Events(q Query) iter.Seq[Event] {
+	return func(yield func(Event) bool) {
+		b.mu.RLock()
+		_, ok, _ := b.start(q.AfterID)
+		lo, hi := seqOf(q.AfterID), b.seq
+		if end := b.bound(q.BeforeID); end == 0 {
+			hi = 0
+		} else if end < len(b.events) {
+			hi = min(hi, seqOf(b.events[end-1].ID))
+		}
+		b.mu.RUnlock()
+
+		if !ok {
+			return
+		}
+
+		skip, n := q.Offset, 0
+		for lo < hi {
+			var chunk []Event
+			chunk, lo, hi = b.chunk(q, lo, hi)
+
+			for _, e := range chunk {
+				if skip > 0 {
+					skip--
+					continue
+				}
+				if !yield(e) {
+					return
+				}
+				if n++; n == q.Limit {
+					return
+				}
+			}
+		}
+	}
+}
+
+// chunk returns up to eventsChunk events matching q among the events whose
+// sequence number is in (lo, hi], in the order of q, and the range left to
+// read.
+func (b *Bus) chunk(q Query, lo, hi uint64) ([]Event, uint64, uint64) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var events []Event
+	now := time.Now()
+	start, end := searchAfter(b.events, lo), searchAfter(b.events, hi)
+	for i := range b.positions(q, start, end, q.Reverse) {
+		e := b.events[i]
+		if e.expired(now) || !q.match(e) {
+			continue
+		}
+
+		events = append(events, e)
+		if len(events) == eventsChunk {
+			if q.Reverse {
+				return events, lo, seqOf(e.ID) - 1
+			}
+			return events, seqOf(e.ID), hi
+		}
+	}
+
+	return events, hi, hi
+}
+
 // Subscribe registers a new subscriber for a topic.
 //
-// topic must be non-empty. To subscribe to all topics, use AllTopics.
+// topic must be non-empty. To subscribe to all topics, use AllTopics, and to
+// subscribe to a family of topics, use a pattern as described on Query.Topic.
 // If topic is empty, Subscribe returns ErrNoTopic.
 //
 // fromID is an exclusive lower bound: events with ID greater than fromID are
 // replayed to the subscriber before live delivery begins. Using Start() as
 // fromID replays all existing events; using End() replays no existing events
-// and only delivers new ones.
+// and only delivers new ones. If fromID is not the ID of an event of the log,
+// Subscribe returns ErrUnknownCursor.
+//
+// Replayed and live events are delivered in the order they were appended to
+// the log, across all topics: replay happens before the subscriber is
+// registered, while publishers are held off, so no live event can overtake
+// history.
 //
-// Delivery is best-effort: if the subscriber's channel buffer is full, both
-// replayed events and live events for that subscriber are silently dropped.
-// Default buffer size is 1024.
+// Replay never drops events: when the history does not fit in the channel
+// buffer, the rest is sent as the subscriber reads, and the subscriber only
+// switches to live events once it has caught up with the log, without gap or
+// duplicate. Events published with PublishUnstored while it catches up are
+// not delivered to it.
+//
+// Live delivery is best-effort: if the subscriber's channel buffer is full,
+// live events for that subscriber are silently dropped. Dropping never
+// reorders the events that are delivered, and dropped events are counted by
+// Subscription.Dropped. Default buffer size is 1024.
 //
 // The returned Subscription's Close function unregisters the subscriber and
 // closes the events channel.
-func (b *Bus) Subscribe(topic string, fromID string) (*Subscription, error) {
-	return b.SubscribeWithBufferSize(topic, fromID, 1024)
+func (b *Bus) Subscribe(topic string, fromID string, opts ...SubscribeOption) (*Subscription, error) {
+	return b.SubscribeWithBufferSize(topic, fromID, 1024, opts...)
 }
 
 // SubscribeWithBufferSize registers a new subscriber and configures its buffer size.
 //
 // Same as Subscribe but lets you choose the buffer size. Returns ErrInvalidBuffer
 // when bufferSize is negative. A bufferSize of 0 creates an unbuffered channel.
-func (b *Bus) SubscribeWithBufferSize(topic string, fromID string, bufferSize int) (*Subscription, error) {
+func (b *Bus) SubscribeWithBufferSize(topic string, fromID string, bufferSize int, opts ...SubscribeOption) (*Subscription, error) {
 	if topic == "" {
 		return nil, ErrNoTopic
 	}
 
-	if bufferSize < 0 {
-		return nil, ErrInvalidBuffer
+	return b.subscribe(Query{Topic: topic, AfterID: fromID}, bufferSize, opts)
+}
+
+// SubscribeContext registers a new subscriber for a topic, like Subscribe,
+// and closes the subscription when ctx is done, so that ranging over C ends
+// with the request or job that owns the subscription.
+func (b *Bus) SubscribeContext(ctx context.Context, topic string, fromID string, opts ...SubscribeOption) (*Subscription, error) {
+	sub, err := b.Subscribe(topic, fromID, opts...)
+	if err != nil {
+		return nil, err
 	}
 
-	sub := &subscriber{
-		topic: topic,
-		ch:    make(chan Event, bufferSize),
+	unsubscribe := sub.Close
+	stop := context.AfterFunc(ctx, unsubscribe)
+	sub.Close = func() {
+		stop()
+		unsubscribe()
 	}
 
-	b.mu.Lock()
-	history := b.filter(Query{
-		Topic:   topic,
-		AfterID: fromID,
-	})
-	b.subscribers[sub] = struct{}{}
-	b.mu.Unlock()
+	return sub, nil
+}
 
-	subscription := &Subscription{
-		C: sub.ch,
-		Close: func() {
-			var ch chan Event
-			b.mu.Lock()
-			if _, ok := b.subscribers[sub]; ok {
-				delete(b.subscribers, sub)
-				ch = sub.ch
-			}
-			b.mu.Unlock()
+// SubscribeTopics registers a new subscriber for several topics at once.
+//
+// It behaves like Subscribe, but delivers the events of all the topics on a
+// single channel, in the order they were appended to the log. If topics is
+// empty or contains an empty topic, SubscribeTopics returns ErrNoTopic.
+func (b *Bus) SubscribeTopics(topics []string, fromID string, opts ...SubscribeOption) (*Subscription, error) {
+	if len(topics) == 0 || slices.Contains(topics, "") {
+		return nil, ErrNoTopic
+	}
 
-			if ch != nil {
-				close(ch)
-			}
-		},
+	return b.subscribe(Query{Topics: topics, AfterID: fromID}, 1024, opts)
+}
+
+// SubscribeSince registers a new subscriber for a topic, like Subscribe,
+// but replays the events published after t instead of after an event ID, for
+// consumers that want, say, the last 24 hours.
+//
+// Replay starts with the first event of the log whose timestamp is after t,
+// and includes every event after it, even the rare ones with an earlier
+// timestamp, such as events imported with their original timestamp.
+func (b *Bus) SubscribeSince(topic string, t time.Time, opts ...SubscribeOption) (*Subscription, error) {
+	if topic == "" {
+		return nil, ErrNoTopic
 	}
 
-	if len(history) > 0 {
-		go func(events []Event, ch chan Event) {
-			for _, e := range events {
-				select {
-				case ch <- e:
-				default:
-					// buffer full: drop replayed event for this subscriber
-				}
+	return b.subscribe(Query{Topic: topic, AfterID: b.before(t)}, 1024, opts)
+}
+
+// before returns the ID of the event preceding the first event whose
+// timestamp is after t, or Start if there is none.
+func (b *Bus) before(t time.Time) string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	i := slices.IndexFunc(b.events, func(e Event) bool {
+		return e.Timestamp.After(t)
+	})
+	if i < 0 {
+		i = len(b.events)
+	}
+	if i > 0 {
+		return b.events[i-1].ID
+	}
+
+	if b.truncatedSeq == 0 {
+		return ""
+	}
+	return strconv.FormatUint(b.truncatedSeq, 10)
+}
+
+// SubscribeQuery registers a new subscriber for the events matching q.
+//
+// It behaves like Subscribe, with q.AfterID as fromID, but every filter of q
+// applies to both replayed and live events, so subscribers only receive the
+// events they care about. An empty q.Topic subscribes to all topics, as in
+// queries. The buffer size is 1024 unless WithBufferSize says otherwise.
+func (b *Bus) SubscribeQuery(q Query, opts ...SubscribeOption) (*Subscription, error) {
+	return b.subscribe(q, 1024, opts)
+}
+
+// WaitFor returns the first event matching q, replayed or live, waiting for
+// it until ctx is done, in which case it returns the context's error. It
+// returns ErrClosed if the bus is closed meanwhile.
+//
+// It saves a subscription and a select loop in request/response flows and
+// tests that wait for a single event.
+func (b *Bus) WaitFor(ctx context.Context, q Query) (Event, error) {
+	sub, err := b.subscribe(q, 1, nil)
+	if err != nil {
+		return Event{}, err
+	}
+	defer sub.Close()
+
+	select {
+	case e, ok := <-sub.C:
+		if !ok {
+			return Event{}, ErrClosed
+		}
+		return e, nil
+	case <-ctx.Done():
+		return Event{}, ctx.Err()
+	}
+}
+
+func (b *Bus) subscribe(q Query, bufferSize int, opts []SubscribeOption) (*Subscription, error) {
+	sub := &subscriber{
+		query:      q,
+		bufferSize: bufferSize,
+	}
+
+	for _, opt := range opts {
+		opt(sub)
+	}
+
+	if sub.bufferSize < 0 {
+		return nil, ErrInvalidBuffer
+	}
+	sub.ch = make(chan Event, sub.bufferSize)
+	sub.quit = make(chan struct{})
+	sub.lastID = sub.query.AfterID
+	if sub.ack != nil {
+		sub.ack.cursor = sub.query.AfterID
+		sub.ack.parkAfter = sub.parkAfter
+	}
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil, ErrClosed
+	}
+	start, ok, trimmed := b.start(sub.query.AfterID)
+	if !ok {
+		b.mu.Unlock()
+		return nil, ErrUnknownCursor
+	}
+	b.subSeq++
+	sub.id = b.subSeq
+
+	if sub.group != "" {
+		from, replay := b.join(sub)
+		switch {
+		case !replay:
+			// the group is already following the log
+			ok, trimmed = false, false
+		case from != sub.query.AfterID:
+			// the group resumes where its last member left
+			sub.lastID = from
+			start, ok, trimmed = b.start(from)
+		}
+	}
+	sub.trimmed(trimmed)
+	pump := false
+	if ok {
+		_, pump = b.catchUp(sub, start)
+	}
+	var ch <-chan Event = sub.ch
+	if sub.coalesce != nil {
+		ch = sub.coalesced(sub.ch)
+	}
+	b.subscribers[sub] = struct{}{}
+	b.mu.Unlock()
+
+	if pump {
+		go b.pump(sub)
+	}
+	if sub.ack != nil {
+		go b.watch(sub)
+	}
+
+	subscription := &Subscription{
+		C:       ch,
+		Trimmed: trimmed,
+		bus:     b,
+		sub:     sub,
+		Close: func() {
+			var ch chan Event
+			b.mu.Lock()
+			if _, ok := b.subscribers[sub]; ok && b.unsubscribe(sub) {
+				ch = sub.ch
 			}
-		}(history, sub.ch)
+			b.mu.Unlock()
+
+			if ch != nil {
+				close(ch)
+			}
+			sub.abandon()
+		},
 	}
 
 	return subscription, nil
@@ -285,18 +1188,154 @@ func (b *Bus) SubscribeWithBufferSize(topic string, fromID string, bufferSize in
 //
 // On success, Publish returns the ID assigned to the new event.
 func (b *Bus) Publish(topic, eventType string, payload any, lastID string) (string, error) {
-	return b.publish(topic, eventType, payload, lastID, true)
+	return b.publish(Event{Topic: topic, Type: eventType, Payload: payload}, lastID, true)
+}
+
+// PublishIfAbsent appends a new event unless the topic already has an event of
+// the same type, which makes initialization events such as "AccountOpened"
+// safe to publish on every start.
+//
+// It returns the new event and true when it was appended, or the first
+// existing event of that topic and type and false otherwise. To require the
+// topic to have no events at all, use Publish with Start() as lastID.
+func (b *Bus) PublishIfAbsent(topic, eventType string, payload any) (Event, bool, error) {
+	if topic == "" {
+		return Event{}, false, ErrNoTopic
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.writable(); err != nil {
+		return Event{}, false, err
+	}
+
+	for _, i := range b.indexByTopic[topic] {
+		if e := b.events[i]; e.Type == eventType {
+			return e, false, nil
+		}
+	}
+
+	e := Event{
+		Topic:     topic,
+		Type:      eventType,
+		Payload:   payload,
+		Timestamp: time.Now().UTC(),
+	}
+	if err := b.admit(e); err != nil {
+		return Event{}, false, err
+	}
+
+	id, err := b.append(e, true)
+	if err != nil {
+		return Event{}, false, err
+	}
+
+	return b.events[b.indexByID[id]], true, nil
+}
+
+// PublishExpecting appends a new event for a topic if the topic is still at
+// expectedVersion.
+//
+// It is an alternative to Publish that uses per-topic version numbers instead
+// of event IDs for optimistic concurrency: a topic with no events is at
+// version 0, and each appended event increments it. Aggregates can keep the
+// Version of the last event they applied and pass it here.
+//
+// If the topic is not at expectedVersion, PublishExpecting returns ErrConflict
+// and does not append. If topic is empty, it returns ErrNoTopic.
+func (b *Bus) PublishExpecting(topic, eventType string, payload any, expectedVersion int) (string, error) {
+	if topic == "" {
+		return "", ErrNoTopic
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.writable(); err != nil {
+		return "", err
+	}
+
+	if b.versions[topic] != expectedVersion {
+		return "", ErrConflict
+	}
+
+	e := Event{
+		Topic:     topic,
+		Type:      eventType,
+		Payload:   payload,
+		Timestamp: time.Now().UTC(),
+	}
+	if err := b.admit(e); err != nil {
+		return "", err
+	}
+
+	return b.append(e, true)
+}
+
+// Version returns the current version of a topic, which is the Version of
+// its last event, or 0 if nothing was ever published on it.
+func (b *Bus) Version(topic string) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.versions[topic]
+}
+
+// PublishWithTTL publishes an event that expires once ttl has elapsed.
+//
+// Same as Publish but sets the event's ExpiresAt. Expired events are skipped
+// by queries and subscription replay, and purged from the log by Sweep.
+// A ttl of zero or less publishes an event that never expires.
+func (b *Bus) PublishWithTTL(topic, eventType string, payload any, lastID string, ttl time.Duration) (string, error) {
+	e := Event{
+		Topic:     topic,
+		Type:      eventType,
+		Payload:   payload,
+		Timestamp: time.Now().UTC(),
+	}
+
+	if ttl > 0 {
+		e.ExpiresAt = e.Timestamp.Add(ttl)
+	}
+
+	return b.publish(e, lastID, true)
 }
 
 // PublishUnstored delivers an event to subscribers without appending it to the log.
 func (b *Bus) PublishUnstored(topic, eventType string, payload any) error {
-	_, err := b.publish(topic, eventType, payload, "", false)
+	_, err := b.publish(Event{Topic: topic, Type: eventType, Payload: payload}, "", false)
 	return err
 }
 
-func (b *Bus) publish(topic, eventType string, payload any, lastID string, store bool) (string, error) {
+// Delivery reports how an event published with PublishSync was fanned out
+// to a subscriber.
+type Delivery struct {
+	// Subscriber is the ID of the subscription, see Subscription.ID, and
+	// Name its name, see WithName.
+	Subscriber uint64
+	Name       string
+
+	// Status is TraceDeliver if the event was sent to the subscriber,
+	// TraceSkip if the subscriber was paused, or ctx was done before there
+	// was room in its buffer, and will get the event later, or TraceDrop if
+	// the event could not be sent, such as when the subscription closed
+	// first.
+	Status string
+}
+
+// PublishSync appends a new event like Publish, then waits until every
+// matching subscriber has received it in its channel, or ctx is done, and
+// returns what happened for each subscriber, by subscription ID.
+//
+// It is meant for tests and callers that need to know the fan-out
+// completed. Subscribers whose buffer is full do not lose the event: they
+// catch up with it from the log, as they would with history, and
+// PublishSync waits for them without holding off other publishers or
+// consumers, which can call back into the bus meanwhile.
+func (b *Bus) PublishSync(ctx context.Context, topic, eventType string, payload any, lastID string) (string, []Delivery, error) {
 	if topic == "" {
-		return "", ErrNoTopic
+		return "", nil, ErrNoTopic
 	}
 
 	e := Event{
@@ -306,41 +1345,331 @@ func (b *Bus) publish(topic, eventType string, payload any, lastID string, store
 		Timestamp: time.Now().UTC(),
 	}
 
+	b.mu.Lock()
+	if err := b.writable(); err != nil {
+		b.mu.Unlock()
+		return "", nil, err
+	}
+
+	if b.advanced(topic, lastID) {
+		b.record(TraceConflict, e, lastID)
+		b.traceTopic(TraceConflict, e, nil)
+		b.mu.Unlock()
+		return "", nil, ErrConflict
+	}
+
+	if err := b.admit(e); err != nil {
+		b.mu.Unlock()
+		return "", nil, err
+	}
+
+	events, err := b.commit(e)
+	if err != nil {
+		b.mu.Unlock()
+		return "", nil, err
+	}
+	e = events[0]
+	deliveries, pending := b.fanOut(e, true)
+	b.mu.Unlock()
+
+	for _, sub := range pending {
+		status := b.await(ctx, sub, e)
+		deliveries = append(deliveries, Delivery{Subscriber: sub.id, Name: sub.name, Status: status})
+	}
+	slices.SortFunc(deliveries, func(a, b Delivery) int {
+		return cmp.Compare(a.Subscriber, b.Subscriber)
+	})
+
+	return e.ID, deliveries, nil
+}
+
+// await waits until the stored event e is in the channel of sub, which is
+// catching up with the log, or ctx is done, and returns the status to report
+// for sub.
+func (b *Bus) await(ctx context.Context, sub *subscriber, e Event) string {
+	seq := seqOf(e.ID)
+	for {
+		b.mu.Lock()
+		status := ""
+		_, open := b.subscribers[sub]
+		switch {
+		case sub.delivered >= seq:
+			status = TraceDeliver
+		case !open:
+			status = TraceDrop
+		case !sub.pumping:
+			// paused: Resume catches up again
+			status = TraceSkip
+		}
+		if status != "" {
+			b.traceTopic(status, e, sub)
+			b.mu.Unlock()
+			return status
+		}
+
+		if sub.progress == nil {
+			sub.progress = make(chan struct{})
+		}
+		progress := sub.progress
+		b.mu.Unlock()
+
+		select {
+		case <-progress:
+		case <-ctx.Done():
+			b.mu.Lock()
+			b.traceTopic(TraceSkip, e, sub)
+			b.mu.Unlock()
+			return TraceSkip
+		}
+	}
+}
+
+// publish timestamps e unless it already is, checks lastID and appends it.
+func (b *Bus) publish(e Event, lastID string, store bool) (string, error) {
+	if e.Topic == "" {
+		return "", ErrNoTopic
+	}
+
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now().UTC()
+	}
+
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	if store && len(b.filter(Query{Topic: topic, AfterID: lastID})) > 0 {
+	if b.closed {
+		return "", ErrClosed
+	}
+
+	if store && b.frozen {
+		return "", ErrFrozen
+	}
+
+	if store && b.advanced(e.Topic, lastID) {
+		b.record(TraceConflict, e, lastID)
+		b.traceTopic(TraceConflict, e, nil)
 		return "", ErrConflict
 	}
 
-	if store {
-		e.ID = b.yieldID()
+	if err := b.admit(e); err != nil {
+		return "", err
+	}
+
+	return b.append(e, store)
+}
+
+// publishUnchecked timestamps e unless it already is and appends it after the
+// current end of the bus, without any concurrency check.
+func (b *Bus) publishUnchecked(e Event) (string, error) {
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now().UTC()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.writable(); err != nil {
+		return "", err
+	}
+
+	if err := b.admit(e); err != nil {
+		return "", err
+	}
+
+	return b.append(e, true)
+}
+
+// append assigns an ID to e, stores it in the log if store is true and
+// delivers it to the matching subscribers. It must be called with b.mu held.
+func (b *Bus) append(e Event, store bool) (string, error) {
+	if !store {
+		b.record(TraceUnstored, e, "")
+		b.traceTopic(TraceUnstored, e, nil)
+		b.fanOut(e, false)
+		return "", nil
+	}
+
+	events, err := b.commit(e)
+	if err != nil {
+		return "", err
+	}
+	b.fanOut(events[0], false)
+
+	return events[0].ID, nil
+}
+
+// commit assigns IDs and versions to events, writes them to the store of the
+// bus, if any, and stores them in the log, all or none. It returns them as
+// stored. It must be called with b.mu held.
+func (b *Bus) commit(events ...Event) ([]Event, error) {
+	if len(events) == 0 {
+		return nil, nil
+	}
+
+	events = slices.Clone(events)
+	versions := make(map[string]int)
+	for i, e := range events {
+		if _, ok := versions[e.Topic]; !ok {
+			versions[e.Topic] = b.versions[e.Topic]
+		}
+		versions[e.Topic]++
+
+		events[i].ID = b.yieldID(i)
+		events[i].Version = versions[e.Topic]
+	}
+
+	if b.store != nil {
+		if err := b.store.Append(events...); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, e := range events {
+		b.seq++
+		b.versions[e.Topic] = e.Version
+		if n := len(b.events); n > 0 && e.Timestamp.Before(b.events[n-1].Timestamp) {
+			b.unordered = true
+		}
 		b.events = append(b.events, e)
 		b.indexByID[e.ID] = len(b.events) - 1
+		b.indexByTopic[e.Topic] = append(b.indexByTopic[e.Topic], len(b.events)-1)
+		b.schedule.cancelOn(e)
+		b.record(TraceAppend, e, "")
+		b.traceTopic(TraceAppend, e, nil)
+	}
+
+	return events, nil
+}
+
+// fanOut delivers e to the matching subscribers without blocking.
+//
+// If sync is true, fanOut also returns what happened for each subscriber,
+// except for those that have yet to receive e from the log, because they
+// are catching up or their buffer is full: they are returned instead, so
+// that the caller can wait for them once b.mu is released. It must be called
+// with b.mu held.
+func (b *Bus) fanOut(e Event, sync bool) ([]Delivery, []*subscriber) {
+	var deliveries []Delivery
+	var pending []*subscriber
+	report := func(sub *subscriber, status string) {
+		b.traceTopic(status, e, sub)
+		if sync {
+			deliveries = append(deliveries, Delivery{Subscriber: sub.id, Name: sub.name, Status: status})
+		}
 	}
 
 	for sub := range b.subscribers {
-		if sub.topic != AllTopics && sub.topic != e.Topic {
+		if sub.group != "" || !sub.match(e) {
 			continue
 		}
 
-		select {
-		case sub.ch <- e:
+		switch {
+		case sub.paused:
+			report(sub, TraceSkip)
+		case sub.pumping:
+			if sync {
+				pending = append(pending, sub)
+				break
+			}
+			report(sub, TraceSkip)
+		case sub.limit != nil && !sub.limit.allow(time.Now()):
+			if e.ID == "" {
+				sub.drop(e)
+				report(sub, TraceDrop)
+				break
+			}
+			// over the limit: the event waits in the log
+			sub.pumping = true
+			go b.pump(sub)
+			if sync {
+				pending = append(pending, sub)
+				break
+			}
+			report(sub, TraceSkip)
+		case sync && len(sub.ch) == cap(sub.ch):
+			// full: the event waits in the log rather than being dropped, and
+			// the pump starts right before it, so that events dropped earlier
+			// are not sent late
+			sub.lastID = strconv.FormatUint(seqOf(e.ID)-1, 10)
+			if b.indexByID[e.ID] > 0 {
+				sub.lastID = b.events[b.indexByID[e.ID]-1].ID
+			} else if b.trimmedSeq == 0 || b.trimmedSeq < seqOf(e.ID)-1 {
+				// nothing before e is in the log, but nothing was trimmed
+				// right before it either
+				at := sub.lastID
+				sub.trimmedAt = &at
+			}
+			sub.pumping = true
+			go b.pump(sub)
+			pending = append(pending, sub)
+		case sub.deliver(e):
+			report(sub, TraceDeliver)
 		default:
-			// buffer full: drop for this subscriber
+			report(sub, TraceDrop)
+		}
+	}
+	for _, g := range b.groups {
+		if sub, ok := g.deliver(e); ok {
+			report(sub, TraceDeliver)
+		} else if sub != nil {
+			report(sub, TraceDrop)
 		}
 	}
 
-	return e.ID, nil
+	return deliveries, pending
 }
 
 // Start returns the logical lower bound ID of the bus.
 //
-// Start represents a position before the first event. It currently returns
-// the empty string, which callers can pass as fromID or lastID when they
-// want to treat the beginning of the bus as their lower bound.
+// Start represents a position before the first event. It returns the empty
+// string, unless history was removed with TruncateBefore, in which case it
+// returns the ID of the last removed event. Callers can pass it as fromID or
+// lastID when they want to treat the beginning of the bus as their lower
+// bound; subscriptions from a truncated Start are marked as Trimmed.
 func (b *Bus) Start() string {
-	return ""
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.truncatedSeq == 0 {
+		return ""
+	}
+
+	return strconv.FormatUint(b.truncatedSeq, 10)
+}
+
+// TruncateBefore removes every event up to and including the event with the
+// given ID, typically once an external archive of those events has been
+// taken. Start then returns id, and subscribers replaying from before it are
+// marked as Trimmed.
+//
+// If id does not exist in the log, TruncateBefore returns ErrNotFound and
+// removes nothing. Unlike publishing, truncating is allowed while the bus is
+// frozen.
+func (b *Bus) TruncateBefore(id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+
+	idx, ok := b.indexByID[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	seq, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return fmt.Errorf("eventbus: invalid id %q", id)
+	}
+
+	// copy so that views sharing the old slice are left untouched
+	b.events = append([]Event(nil), b.events[idx+1:]...)
+	b.truncatedSeq = seq
+	b.trimmedSeq = max(b.trimmedSeq, seq)
+	b.reindex()
+
+	return nil
 }
 
 // End returns the ID of the last event in the bus.
@@ -349,8 +1678,8 @@ func (b *Bus) Start() string {
 // value returned by End as fromID when subscribing, or as lastID when
 // publishing, to treat the current end of the bus as their lower bound.
 func (b *Bus) End() string {
-	b.mu.Lock()
-	defer b.mu.Unlock()
+	b.mu.RLock()
+	defer b.mu.RUnlock()
 
 	if len(b.events) == 0 {
 		return ""
@@ -359,78 +1688,509 @@ func (b *Bus) End() string {
 	return b.events[len(b.events)-1].ID
 }
 
-// Dump writes a JSON snapshot of all events to w.
-// It does not affect subscribers.
-func (b *Bus) Dump(w io.Writer) error {
-	b.mu.Lock()
-	events := append([]Event(nil), b.events...)
-	b.mu.Unlock()
+// EndOf returns the ID of the last event of a topic.
+//
+// If the topic has no events, EndOf returns the empty string. Unlike End,
+// the value returned by EndOf is only affected by events of that topic, so
+// publishers can pass it as lastID to append after the last event they know
+// of on this topic without conflicting with unrelated topics.
+func (b *Bus) EndOf(topic string) string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	idx := b.indexByTopic[topic]
+	if len(idx) == 0 {
+		return ""
+	}
+
+	return b.events[idx[len(idx)-1]].ID
+}
+
+// LastEvent returns the most recent event of a topic, and false if the
+// topic has none, which suits state-like topics where only the head
+// matters, such as the latest configuration. Unlike EndOf, it skips expired
+// events, as queries do.
+func (b *Bus) LastEvent(topic string) (Event, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	now := time.Now()
+	idx := b.indexByTopic[topic]
+	for i := len(idx) - 1; i >= 0; i-- {
+		if e := b.events[idx[i]]; !e.expired(now) {
+			return e, true
+		}
+	}
+
+	return Event{}, false
+}
+
+// DumpFormat is the version of the document written by Dump.
+//
+// Load reads documents of this format and of every earlier one, upgrading
+// them with explicit migration steps. It also reads documents of later
+// formats, as long as they declare being compatible with this one.
+const DumpFormat = 2
+
+// dumpCompat is the oldest format whose readers can load the documents
+// written by Dump: format 2 only adds event versions, which format 1 readers
+// recompute.
+const dumpCompat = 1
+
+// dump is the JSON document written by Dump and read by Load.
+//
+// Format 0 is a plain JSON array of events. Format 1 wraps it in an object
+// with the scheduled events. Format 2 adds the format fields and per-topic
+// event versions.
+type dump struct {
+	Format    int         `json:"format"`
+	Compat    int         `json:"compat"`
+	Events    []Event     `json:"events"`
+	Scheduled []scheduled `json:"scheduled,omitempty"`
+}
 
-	enc := json.NewEncoder(w)
-	enc.SetIndent("", "  ")
+// migrations upgrade a dump by one format: migrations[i] turns a format i
+// document into a format i+1 one.
+var migrations = []func(*dump){
+	// plain arrays only differ in shape, which decodeDump takes care of
+	0: func(*dump) {},
+
+	// events gain the version they have within their topic
+	1: func(d *dump) {
+		versions := make(map[string]int)
+		for i, e := range d.Events {
+			if e.Version == 0 {
+				d.Events[i].Version = versions[e.Topic] + 1
+			}
+			versions[e.Topic] = d.Events[i].Version
+		}
+	},
+}
+
+// decodeDump decodes a document of any known format and migrates it to
+// DumpFormat.
+func decodeDump(raw json.RawMessage) (dump, error) {
+	var d dump
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(raw, &d.Events); err != nil {
+			return d, err
+		}
+		d.Format = 0
+	} else {
+		if err := json.Unmarshal(raw, &d); err != nil {
+			return d, err
+		}
+		if d.Format == 0 {
+			// objects without a format predate format 2
+			d.Format = 1
+		}
+	}
+
+	if d.Format > DumpFormat {
+		if d.Compat == 0 || d.Compat > DumpFormat {
+			return d, fmt.Errorf("%w: format %d", ErrUnsupportedFormat, d.Format)
+		}
+		return d, nil
+	}
+
+	for _, migrate := range migrations[d.Format:] {
+		migrate(&d)
+	}
+	d.Format = DumpFormat
 
-	return enc.Encode(events)
+	return d, nil
 }
 
-// Load reads events as JSON from r and replaces the current log.
+// Dump writes a JSON snapshot of all events to w, along with the events
+// scheduled with PublishAt that are not due yet.
+// It does not affect subscribers.
+func (b *Bus) Dump(w io.Writer) error {
+	return b.Snapshot().Dump(w)
+}
+
+// Load reads events as JSON from r and replaces the current log and the
+// pending scheduled events. Documents written by older versions of Dump are
+// migrated on the fly, see DumpFormat.
 //
 // The new events take effect atomically with respect to subscribers, but no
-// notifications are sent: subscribers are not rewound or updated.
+// notifications are sent: subscribers are not rewound or updated. Scheduled
+// events that are already due are published right away.
 //
 // Load trusts the IDs in the input. Future calls to Publish rely on those IDs
-// being unique and parseable; invalid or non-sequential IDs may cause Publish
-// to panic when generating the next ID.
+// being unique and sequential; Load returns an error if the last ID cannot be
+// parsed. IDs below the first loaded event are considered trimmed, as if
+// retention had removed them.
+//
+// A bus created with NewWithStore cannot be loaded: Load returns ErrHasStore
+// and leaves the log unchanged, as the store would otherwise disagree with
+// the log about which IDs exist. To seed a store from a dump, load it into a
+// plain bus and append its events to the store before NewWithStore.
 func (b *Bus) Load(r io.Reader) error {
-	var events []Event
-	if err := json.NewDecoder(r).Decode(&events); err != nil {
+	r, err := b.keys().decrypter(r)
+	if err != nil {
+		return err
+	}
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return err
+	}
+
+	d, err := decodeDump(raw)
+	if err != nil {
 		return err
 	}
 
+	return b.restore(d)
+}
+
+// restore replaces the log and the pending scheduled events with those of d.
+func (b *Bus) restore(d dump) error {
+	events := d.Events
+
+	var first, last uint64
+	if len(events) > 0 {
+		var err error
+		if last, err = strconv.ParseUint(events[len(events)-1].ID, 10, 64); err != nil {
+			return fmt.Errorf("eventbus: invalid id %q", events[len(events)-1].ID)
+		}
+		first, _ = strconv.ParseUint(events[0].ID, 10, 64)
+	}
+
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
+	if b.store != nil {
+		return ErrHasStore
+	}
+
 	b.events = append([]Event(nil), events...)
+	b.versions = make(map[string]int)
+	for _, e := range b.events {
+		b.versions[e.Topic] = e.Version
+	}
+	b.seq = last
+	b.trimmedSeq = 0
+	b.truncatedSeq = 0
+	if first > 0 {
+		b.trimmedSeq = first - 1
+		b.truncatedSeq = first - 1
+	}
+
+	b.reindex()
+	b.schedule.reset(d.Scheduled)
+	b.armSchedule()
+
+	return nil
+}
+
+// Freeze stops the log from changing until Unfreeze is called, so that
+// maintenance such as a backup or a migration gets a consistent view without
+// stopping the process.
+//
+// While the bus is frozen, every call that would append to the log returns
+// ErrFrozen, scheduled events stay pending and Sweep removes nothing.
+// Queries, subscriptions and PublishUnstored keep working.
+func (b *Bus) Freeze() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.frozen = true
+}
+
+// Unfreeze lets the log change again after Freeze, and publishes the scheduled
+// events that became due in the meantime.
+func (b *Bus) Unfreeze() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.frozen = false
+	b.armSchedule()
+}
 
+// writable returns the error to report when appending to the log is not
+// possible. It must be called with b.mu held.
+func (b *Bus) writable() error {
+	if b.closed {
+		return ErrClosed
+	}
+	if b.frozen {
+		return ErrFrozen
+	}
+	return nil
+}
+
+// reindex rebuilds indexByID and indexByTopic, and checks the timestamp
+// order of the log, after it has been replaced or compacted.
+func (b *Bus) reindex() {
 	b.indexByID = make(map[string]int, len(b.events))
+	b.indexByTopic = make(map[string][]int)
 
 	for i, e := range b.events {
 		b.indexByID[e.ID] = i
+		b.indexByTopic[e.Topic] = append(b.indexByTopic[e.Topic], i)
+	}
+
+	b.unordered = !slices.IsSortedFunc(b.events, func(a, b Event) int {
+		return a.Timestamp.Compare(b.Timestamp)
+	})
+}
+
+// Close stops background work such as the retention sweeper and closes the
+// channels of all subscribers. Publish and Subscribe return ErrClosed
+// afterwards. Close is safe to call more than once.
+func (b *Bus) Close() {
+	for sub := range b.detach() {
+		close(sub.ch)
+	}
+}
+
+// Shutdown closes the bus like Close, but closes subscriptions in increasing
+// order of priority, as set with WithShutdownPriority, and waits for the
+// consumers of each priority to drain their channel before moving on to the
+// next one. Handlers and sinks are drained once they have processed their
+// last event.
+//
+// If ctx is done before every consumer has drained, the remaining
+// subscriptions are closed at once and Shutdown returns ctx.Err().
+func (b *Bus) Shutdown(ctx context.Context) error {
+	levels := make(map[int][]*subscriber)
+	for sub := range b.detach() {
+		levels[sub.priority] = append(levels[sub.priority], sub)
+	}
+
+	priorities := slices.Sorted(maps.Keys(levels))
+	for i, p := range priorities {
+		for _, sub := range levels[p] {
+			close(sub.ch)
+		}
+
+		for _, sub := range levels[p] {
+			if err := sub.drain(ctx); err != nil {
+				for _, p := range priorities[i+1:] {
+					for _, sub := range levels[p] {
+						close(sub.ch)
+						sub.abandon()
+					}
+				}
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// drain waits until the consumer of a closed subscriber is done, or at least
+// has read everything left in the channel.
+func (s *subscriber) drain(ctx context.Context) error {
+	if s.finished != nil {
+		select {
+		case <-s.finished:
+			return nil
+		case <-ctx.Done():
+			s.abandon()
+			return ctx.Err()
+		}
+	}
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for len(s.ch) > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
 
 	return nil
 }
 
-// SaveToFile dumps all events to the given path as JSON, overwriting the file
+// detach marks the bus as closed, stops background work and unregisters all
+// subscribers, which it returns so that their channels can be closed. It
+// returns nothing if the bus was already closed.
+func (b *Bus) detach() map[*subscriber]struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	if b.sweeper != nil {
+		close(b.sweeper)
+		b.sweeper = nil
+	}
+	if b.autosave != nil {
+		close(b.autosave)
+		b.autosave = nil
+	}
+	subs := b.subscribers
+	b.subscribers = make(map[*subscriber]struct{})
+	b.groups = make(map[string]*group)
+
+	for sub := range subs {
+		sub.closing(ErrClosed)
+		if sub.pumping {
+			// the pump closes the channel
+			close(sub.quit)
+			delete(subs, sub)
+		}
+	}
+
+	return subs
+}
+
+// SaveToFile dumps all events to the given path as JSON, replacing the file
 // if it exists. The write is a snapshot and does not affect subscribers.
-func (b *Bus) SaveToFile(path string) error {
-	f, err := os.Create(path)
+//
+// Paths ending in .gz, .zst or .sz are compressed with the gzip, zstd or
+// snappy codec, which must be registered except for gzip.
+//
+// The dump is written to a temporary file in the same directory, synced, and
+// renamed over path, so that path holds either the previous log or the new
+// one in full, even if the process or the machine crashes in the middle.
+// An existing file keeps its permissions, and a new one is only readable and
+// writable by its owner.
+func (b *Bus) SaveToFile(path string, opts ...SaveOption) error {
+	var o saveOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	dump := b.Dump
+	if codec := codecForExt(path); codec != "" {
+		dump = func(w io.Writer) error { return b.DumpCompressed(w, codec) }
+	}
+
+	return writeFileAtomic(path, o.syncDir, dump)
+}
+
+// SaveOption configures SaveToFile and AutoSave.
+type SaveOption func(*saveOptions)
+
+type saveOptions struct {
+	syncDir bool
+}
+
+// WithDirSync also syncs the directory after the rename, so that the new
+// file survives a power loss and not only a crash of the process, at the
+// cost of an extra sync on each save.
+func WithDirSync() SaveOption {
+	return func(o *saveOptions) {
+		o.syncDir = true
+	}
+}
+
+// writeFileAtomic calls write with a temporary file in the directory of
+// path, and renames it to path once it is written and synced. If syncDir is
+// true, the directory is synced as well so that the rename is durable.
+func writeFileAtomic(path string, syncDir bool, write func(w io.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
 	if err != nil {
 		return err
 	}
-	defer f.Close()
+	defer os.Remove(f.Name())
+
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	// keep the mode of the file being replaced; new files stay private to
+	// the owner, as created by CreateTemp
+	if info, err := os.Stat(path); err == nil {
+		if err := f.Chmod(info.Mode().Perm()); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
 
-	return b.Dump(f)
+	if err := os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+	if !syncDir {
+		return nil
+	}
+
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	return dir.Sync()
 }
 
 // NewFromFile creates a new Bus and loads events from the given JSON file.
 //
 // If the file does not exist, NewFromFile returns an empty bus and a nil error.
 // If the file exists but cannot be decoded, an error is returned.
+//
+// Files compressed by SaveToFile or DumpCompressed are recognized by the
+// first bytes of the stream, whatever their name, and decompressed with the
+// matching codec. To load an encrypted file, call SetKeyring on a new bus and
+// then LoadFromFile.
 func NewFromFile(path string) (*Bus, error) {
 	b := New()
+	if err := b.LoadFromFile(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
 
+	return b, nil
+}
+
+// LoadFromFile replaces the log with the events of a file written by
+// SaveToFile, like Load does. Compressed files are recognized as with
+// NewFromFile, and encrypted ones are decrypted with the keyring of the bus.
+func (b *Bus) LoadFromFile(path string) error {
 	f, err := os.Open(path)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return b, nil
-		}
-		return nil, err
+		return err
 	}
 	defer f.Close()
 
-	if err := b.Load(f); err != nil {
-		return nil, err
+	r, err := b.keys().decrypter(f)
+	if err != nil {
+		return err
 	}
 
-	return b, nil
+	head, _ := r.Peek(8)
+	if codec := codecForMagic(head); codec != "" {
+		return b.LoadCompressed(r, codec)
+	}
+	return b.Load(r)
+}
+
+// SetKeyring makes Dump, and so SaveToFile and AutoSave, encrypt their output
+// with the current key of k, and Load decrypt it. Unencrypted dumps still
+// load, so that existing files can be migrated by loading and saving them
+// once. A nil keyring turns encryption off.
+//
+// DumpNDJSON and DumpSince are not encrypted, so that their output can still
+// be appended to and tailed: send it over an encrypted connection, or use an
+// encrypted WAL, see OpenEncryptedWAL.
+func (b *Bus) SetKeyring(k *Keyring) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.keyring = k
+}
+
+func (b *Bus) keys() *Keyring {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.keyring
 }
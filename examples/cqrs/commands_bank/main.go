@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"time"
@@ -16,17 +17,21 @@ func main() {
 	sub, _ := bus.Subscribe(accountTopic, bus.Start())
 	defer sub.Close()
 
+	done := make(chan struct{})
 	go func() {
 		for e := range sub.C {
 			projection.Apply(e)
 		}
+		close(done)
 	}()
 
 	handleCommand(bus, accountTopic, command{Name: "Deposit", Amount: 100})
 	handleCommand(bus, accountTopic, command{Name: "Withdraw", Amount: 25})
 	handleCommand(bus, accountTopic, command{Name: "Deposit", Amount: 50})
 
-	time.Sleep(50 * time.Millisecond)
+	// every event is in the channel: let the projection apply them
+	sub.Close()
+	<-done
 
 	fmt.Printf("current balance: %d\n", projection.Value())
 }
@@ -39,7 +44,7 @@ type command struct {
 func handleCommand(bus *eventbus.Bus, topic string, cmd command) {
 	switch cmd.Name {
 	case "Deposit":
-		bus.Publish(topic, "Deposited", cmd.Amount, bus.End())
+		publish(bus, topic, "Deposited", cmd.Amount, bus.End())
 
 	case "Withdraw":
 		balance, id := replayBalance(bus, topic)
@@ -49,18 +54,23 @@ func handleCommand(bus *eventbus.Bus, topic string, cmd command) {
 			return
 		}
 
-		bus.Publish(topic, "Withdrawn", cmd.Amount, id)
+		publish(bus, topic, "Withdrawn", cmd.Amount, id)
 
 	default:
 		fmt.Printf("unknown command %q ignored\n", cmd.Name)
 	}
 }
 
-func replayBalance(bus *eventbus.Bus, topic string) (int, string) {
-	balance := 0
-	id := bus.Start()
+// publish waits until the projection has the event in its channel.
+func publish(bus *eventbus.Bus, topic, eventType string, amount int, lastID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	bus.PublishSync(ctx, topic, eventType, amount, lastID)
+}
 
-	bus.ForEachEvent(eventbus.Query{Topic: topic}, func(e eventbus.Event) {
+func replayBalance(bus *eventbus.Bus, topic string) (int, string) {
+	return eventbus.Fold(bus, eventbus.Query{Topic: topic}, 0, func(balance int, e eventbus.Event) int {
 		amt := e.Payload.(int)
 		if e.Type == "Deposited" {
 			balance += amt
@@ -68,10 +78,8 @@ func replayBalance(bus *eventbus.Bus, topic string) (int, string) {
 		if e.Type == "Withdrawn" {
 			balance -= amt
 		}
-		id = e.ID
+		return balance
 	})
-
-	return balance, id
 }
 
 type balanceProjection struct {
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"sync"
@@ -24,7 +25,11 @@ func main() {
 	publishOrder(bus, mealBurger)
 	publishOrder(bus, mealPizza)
 
-	sub, err := bus.Subscribe("orders", bus.Start())
+	sub, err := bus.SubscribeQuery(eventbus.Query{
+		Topic:   "orders",
+		Type:    "order_placed",
+		AfterID: bus.Start(),
+	})
 	if err != nil {
 		log.Fatalf("subscribe: %v", err)
 	}
@@ -33,11 +38,13 @@ func main() {
 	ingredients := newIngredientProjection()
 	revenue := newRevenueProjection()
 
+	done := make(chan struct{})
 	go func() {
 		for e := range sub.C {
 			ingredients.apply(e)
 			revenue.apply(e)
 		}
+		close(done)
 	}()
 
 	// Live orders.
@@ -45,7 +52,9 @@ func main() {
 	publishOrder(bus, mealBurger)
 	publishOrder(bus, mealPizza)
 
-	time.Sleep(50 * time.Millisecond)
+	// every order is in the channel: let the projections apply them
+	sub.Close()
+	<-done
 
 	fmt.Println("Ingredient needs:")
 	for ing, count := range ingredients.snapshot() {
@@ -56,7 +65,10 @@ func main() {
 }
 
 func publishOrder(bus *eventbus.Bus, item meal) {
-	_, err := bus.Publish("orders", "order_placed", string(item), bus.End())
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, _, err := bus.PublishSync(ctx, "orders", "order_placed", string(item), bus.End())
 	if err != nil {
 		log.Fatalf("publish order: %v", err)
 	}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"time"
@@ -22,16 +23,32 @@ func main() {
 	}
 	defer sub.Close()
 
-	go readMessages("alex", sub.C)
+	presence := eventbus.NewPresence(bus, "sports.presence", time.Minute)
+	if err := presence.Join("alex"); err != nil {
+		log.Fatalf("join: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		readMessages("alex", sub.C)
+		close(done)
+	}()
 
 	postMessage(bus, message{From: "coach", Text: "Welcome to #sports."})
 	postMessage(bus, message{From: "coach", Text: "Practice at 6pm. Bring water."})
 
-	time.Sleep(50 * time.Millisecond)
+	// the messages are all in the channel: let the reader finish them
+	sub.Close()
+	<-done
+
+	fmt.Printf("Online: %v\n", presence.Members())
 }
 
 func postMessage(bus *eventbus.Bus, payload message) {
-	_, err := bus.Publish("sports", "MessagePosted", payload, bus.End())
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, _, err := bus.PublishSync(ctx, "sports", "MessagePosted", payload, bus.End())
 	if err != nil {
 		log.Fatalf("publish sports: %v", err)
 	}
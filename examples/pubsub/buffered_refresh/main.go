@@ -12,7 +12,8 @@ func main() {
 	bus := eventbus.New()
 
 	// Car dashboard subscribes with buffer size 1: many low-fuel signals collapse into "latest only".
-	sub, err := bus.SubscribeWithBufferSize("fuel", bus.Start(), 1)
+	latest := eventbus.WithCoalesce(func(e eventbus.Event) string { return e.Topic })
+	sub, err := bus.SubscribeWithBufferSize("fuel", bus.Start(), 1, latest)
 	if err != nil {
 		log.Fatalf("subscribe: %v", err)
 	}
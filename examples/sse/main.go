@@ -16,18 +16,17 @@ func main() {
 	bus.Publish("notifications", "Ping", "world", last)
 
 	http.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
-		lastID := r.Header.Get("Last-Event-ID")
-		sub, _ := bus.Subscribe("notifications", lastID)
-		defer sub.Close()
+		// a client may come back with an ID from before a server restart
+		lastID, err := bus.ResolveNearestCursor(r.Header.Get("Last-Event-ID"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sub, _ := bus.SubscribeContext(r.Context(), "notifications", lastID)
 
 		sse, _ := newSSE(w)
-		for {
-			select {
-			case e := <-sub.C:
-				sse.Write(e)
-			case <-r.Context().Done():
-				return
-			}
+		for e := range sub.C {
+			sse.Write(e)
 		}
 	})
 
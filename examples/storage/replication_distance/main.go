@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	_ "embed"
 	"fmt"
 	"io"
 	"log"
@@ -11,12 +12,16 @@ import (
 	"github.com/lobre/eventbus"
 )
 
+//go:embed seed.json
+var seedFixture []byte
+
 func main() {
 	seed := eventbus.New()
 
 	// seed with a couple of past runs
-	recordActivity(seed, 5.2)
-	recordActivity(seed, 3.8)
+	if err := eventbus.LoadFixture(seed, bytes.NewReader(seedFixture), nil); err != nil {
+		log.Fatalf("load fixture: %v", err)
+	}
 
 	remote := newHTTPMock(seed)
 	client := &http.Client{Transport: remote}
@@ -31,7 +36,7 @@ func main() {
 	}
 	defer sub.Close()
 
-	go replicate(bus, client, url, sub.C)
+	go replicate(bus, client, url, bus.End(), sub.C)
 
 	for _, km := range []float64{4.0, 6.5, 2.3, 5.7} {
 		recordActivity(bus, km)
@@ -59,7 +64,7 @@ func totalKm(bus *eventbus.Bus) float64 {
 	return sum
 }
 
-func replicate(bus *eventbus.Bus, client *http.Client, url string, ch <-chan eventbus.Event) {
+func replicate(bus *eventbus.Bus, client *http.Client, url string, synced string, ch <-chan eventbus.Event) {
 	count := 0
 	for range ch {
 		count++
@@ -68,7 +73,7 @@ func replicate(bus *eventbus.Bus, client *http.Client, url string, ch <-chan eve
 		}
 
 		// replicate every 2 events
-		patchBusToURL(bus, client, url)
+		synced = patchBusToURL(bus, client, url, synced)
 	}
 }
 
@@ -85,18 +90,25 @@ func fetchBusFromURL(client *http.Client, url string) *eventbus.Bus {
 	}
 
 	bus := eventbus.New()
-	if err := bus.Load(resp.Body); err != nil {
+	if err := bus.LoadNDJSON(resp.Body); err != nil {
 		log.Fatalf("load bus: %v", err)
 	}
 
 	return bus
 }
 
-func patchBusToURL(bus *eventbus.Bus, client *http.Client, url string) {
+// patchBusToURL sends the events after synced to the remote, which appends
+// them to its copy, and returns the last ID sent.
+func patchBusToURL(bus *eventbus.Bus, client *http.Client, url string, synced string) string {
+	view := bus.Snapshot()
+
 	var buf bytes.Buffer
-	if err := bus.Dump(&buf); err != nil {
+	if err := view.DumpSince(&buf, synced); err != nil {
 		log.Fatalf("dump: %v", err)
 	}
+	if buf.Len() == 0 {
+		return synced
+	}
 
 	req, err := http.NewRequest(http.MethodPatch, url, bytes.NewReader(buf.Bytes()))
 	if err != nil {
@@ -113,5 +125,7 @@ func patchBusToURL(bus *eventbus.Bus, client *http.Client, url string) {
 		body, _ := io.ReadAll(resp.Body)
 		log.Fatalf("replicate status %d: %s", resp.StatusCode, string(body))
 	}
-	fmt.Println("replicated to remote")
+	fmt.Printf("replicated %d bytes to remote\n", buf.Len())
+
+	return view.End()
 }
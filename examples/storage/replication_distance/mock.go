@@ -17,7 +17,7 @@ type httpMock struct {
 
 func newHTTPMock(seed *eventbus.Bus) *httpMock {
 	var buf bytes.Buffer
-	if err := seed.Dump(&buf); err != nil {
+	if err := seed.DumpNDJSON(&buf); err != nil {
 		log.Fatalf("seed dump: %v", err)
 	}
 	return &httpMock{data: buf.Bytes()}
@@ -44,7 +44,7 @@ func (m *httpMock) handleGet() (*http.Response, error) {
 
 	return &http.Response{
 		StatusCode: http.StatusOK,
-		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Header:     http.Header{"Content-Type": []string{"application/x-ndjson"}},
 		Body:       io.NopCloser(bytes.NewReader(data)),
 	}, nil
 }
@@ -59,7 +59,7 @@ func (m *httpMock) handlePatch(req *http.Request) (*http.Response, error) {
 	}
 
 	m.mu.Lock()
-	m.data = append([]byte(nil), body...)
+	m.data = append(m.data, body...)
 	m.mu.Unlock()
 
 	return &http.Response{
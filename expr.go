@@ -0,0 +1,351 @@
+package eventbus
+
+import (
+	"cmp"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expr is a filter expression compiled by CompileExpr, such as
+//
+//	type == "Withdrawn" && payload.amount > 100
+//
+// Unlike Go closures, expressions are plain strings, so they can come from
+// configuration files, operator tooling or remote APIs.
+//
+// Operands are the event fields id, topic, type and version, payload fields
+// located as in Where, such as payload.address.city or payload.items[0].qty,
+// and literals: double-quoted strings, numbers, true, false and null.
+// Operators are ==, !=, <, <=, >, >=, &&, || and !, with parentheses for
+// grouping. Values are compared as they would be encoded in JSON; ordering
+// applies to numbers and to strings, and comparing a missing field or values
+// of different kinds is false.
+type Expr struct {
+	src  string
+	eval func(Event) any
+}
+
+// CompileExpr parses an expression once, so that matching events does not
+// parse it again. It returns an error wrapping ErrInvalidExpr if src is not
+// a valid expression.
+func CompileExpr(src string) (*Expr, error) {
+	p := &parser{src: src}
+	p.next()
+
+	eval, err := p.or()
+	if err == nil && p.tok.kind != tokEOF {
+		err = p.fail("unexpected %q", p.tok.text)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Expr{src: src, eval: eval}, nil
+}
+
+// Match reports whether the expression holds for e.
+func (x *Expr) Match(e Event) bool {
+	return x.eval(e) == true
+}
+
+// Eval returns the value of the expression for e, as it would be decoded
+// from JSON: a float64, string, bool, map or slice, or nil for null and for a
+// missing payload field. Comparisons and logical operators yield a bool.
+func (x *Expr) Eval(e Event) any {
+	v := x.eval(e)
+	if v == (missing{}) {
+		return nil
+	}
+	return v
+}
+
+// String returns the source of the expression.
+func (x *Expr) String() string {
+	return x.src
+}
+
+// missing is the value of a payload field that does not exist.
+type missing struct{}
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+type parser struct {
+	src string
+	pos int
+	tok token
+}
+
+func (p *parser) fail(format string, args ...any) error {
+	return fmt.Errorf("%w: %s at offset %d", ErrInvalidExpr, fmt.Sprintf(format, args...), p.tok.pos)
+}
+
+// next reads the next token into p.tok.
+func (p *parser) next() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+
+	start := p.pos
+	if p.pos == len(p.src) {
+		p.tok = token{kind: tokEOF, pos: start}
+		return
+	}
+
+	c := p.src[p.pos]
+	switch {
+	case c == '"':
+		p.pos++
+		for p.pos < len(p.src) && p.src[p.pos] != '"' {
+			if p.src[p.pos] == '\\' {
+				p.pos++
+			}
+			p.pos++
+		}
+		p.pos = min(p.pos+1, len(p.src))
+		p.tok = token{kind: tokString, text: p.src[start:p.pos], pos: start}
+
+	case c == '-' || c >= '0' && c <= '9':
+		p.pos++
+		for p.pos < len(p.src) && strings.IndexByte("0123456789.eE+-", p.src[p.pos]) >= 0 {
+			if (p.src[p.pos] == '+' || p.src[p.pos] == '-') && !strings.ContainsRune("eE", rune(p.src[p.pos-1])) {
+				break
+			}
+			p.pos++
+		}
+		p.tok = token{kind: tokNumber, text: p.src[start:p.pos], pos: start}
+
+	case c == '_' || unicode.IsLetter(rune(c)):
+		for p.pos < len(p.src) && (strings.IndexByte("_.[]", p.src[p.pos]) >= 0 || unicode.IsLetter(rune(p.src[p.pos])) || unicode.IsDigit(rune(p.src[p.pos]))) {
+			p.pos++
+		}
+		p.tok = token{kind: tokIdent, text: p.src[start:p.pos], pos: start}
+
+	default:
+		for _, op := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")"} {
+			if strings.HasPrefix(p.src[p.pos:], op) {
+				p.pos += len(op)
+				p.tok = token{kind: tokOp, text: op, pos: start}
+				return
+			}
+		}
+		p.pos++
+		p.tok = token{kind: tokOp, text: p.src[start:p.pos], pos: start}
+	}
+}
+
+// accept consumes the current token if it is the operator op.
+func (p *parser) accept(op string) bool {
+	if p.tok.kind == tokOp && p.tok.text == op {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) or() (func(Event) any, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("||") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(e Event) any { return l(e) == true || right(e) == true }
+	}
+
+	return left, nil
+}
+
+func (p *parser) and() (func(Event) any, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("&&") {
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(e Event) any { return l(e) == true && right(e) == true }
+	}
+
+	return left, nil
+}
+
+func (p *parser) unary() (func(Event) any, error) {
+	if p.accept("!") {
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(e Event) any { return operand(e) != true }, nil
+	}
+
+	return p.comparison()
+}
+
+func (p *parser) comparison() (func(Event) any, error) {
+	left, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.tok.kind != tokOp {
+		return left, nil
+	}
+
+	op := p.tok.text
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return left, nil
+	}
+	p.next()
+
+	right, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(e Event) any { return compare(op, left(e), right(e)) }, nil
+}
+
+func (p *parser) primary() (func(Event) any, error) {
+	tok := p.tok
+
+	switch tok.kind {
+	case tokOp:
+		if !p.accept("(") {
+			return nil, p.fail("unexpected %q", tok.text)
+		}
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, p.fail("missing )")
+		}
+		return inner, nil
+
+	case tokString:
+		s, err := strconv.Unquote(tok.text)
+		if err != nil {
+			return nil, p.fail("invalid string %s", tok.text)
+		}
+		p.next()
+		return func(Event) any { return s }, nil
+
+	case tokNumber:
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, p.fail("invalid number %s", tok.text)
+		}
+		p.next()
+		return func(Event) any { return f }, nil
+
+	case tokIdent:
+		p.next()
+		return p.operand(tok)
+	}
+
+	return nil, p.fail("unexpected end of expression")
+}
+
+// operand returns the evaluator of a literal or field name.
+func (p *parser) operand(tok token) (func(Event) any, error) {
+	switch tok.text {
+	case "true":
+		return func(Event) any { return true }, nil
+	case "false":
+		return func(Event) any { return false }, nil
+	case "null":
+		return func(Event) any { return nil }, nil
+	case "id":
+		return func(e Event) any { return e.ID }, nil
+	case "topic":
+		return func(e Event) any { return e.Topic }, nil
+	case "type":
+		return func(e Event) any { return e.Type }, nil
+	case "version":
+		return func(e Event) any { return float64(e.Version) }, nil
+	}
+
+	path, ok := strings.CutPrefix(tok.text, "payload")
+	if !ok || path != "" && path[0] != '.' && path[0] != '[' {
+		return nil, fmt.Errorf("%w: unknown field %q at offset %d", ErrInvalidExpr, tok.text, tok.pos)
+	}
+
+	return func(e Event) any {
+		v, ok := field(e.Payload, path)
+		if !ok {
+			return missing{}
+		}
+		return v
+	}, nil
+}
+
+// compare applies a comparison operator to two JSON values.
+func compare(op string, a, b any) bool {
+	if a == (missing{}) || b == (missing{}) {
+		return false
+	}
+
+	switch op {
+	case "==":
+		return reflect.DeepEqual(a, b)
+	case "!=":
+		return !reflect.DeepEqual(a, b)
+	}
+
+	var c int
+	switch x := a.(type) {
+	case float64:
+		y, ok := b.(float64)
+		if !ok {
+			return false
+		}
+		c = cmp.Compare(x, y)
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return false
+		}
+		c = strings.Compare(x, y)
+	default:
+		return false
+	}
+
+	switch op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
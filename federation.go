@@ -0,0 +1,322 @@
+package eventbus
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// Manifest declares which topics a bus shares with its peers and which
+// topics it follows from them, so that services can share selected streams
+// without writing a bridge for each topic.
+//
+// A manifest is typically kept in a JSON file next to the service:
+//
+//	{
+//	  "exports": ["orders", "payments.*"],
+//	  "imports": [
+//	    {"peer": "http://billing:8080/events", "topics": ["invoices"], "prefix": "billing."}
+//	  ]
+//	}
+type Manifest struct {
+	// Exports lists the topics, or topic patterns, that peers can read from
+	// the handler returned by ExportHandler.
+	Exports []string `json:"exports"`
+
+	// Imports lists the topics to copy from peers.
+	Imports []Import `json:"imports"`
+}
+
+// Import describes topics copied from a peer.
+type Import struct {
+	// Name identifies the import in checkpoints and Federation.Errors, and
+	// defaults to Peer. Imports of a manifest must have different names,
+	// so several imports from the same peer need one.
+	Name string `json:"name,omitempty"`
+
+	// Peer is the URL of the peer's ExportHandler.
+	Peer string `json:"peer"`
+
+	// Topics lists the topics, or topic patterns, to copy. An empty list
+	// copies everything the peer exports.
+	Topics []string `json:"topics,omitempty"`
+
+	// Prefix is prepended to the topics of imported events, so that they
+	// cannot collide with local topics.
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// key returns the name of the import, or its peer if it has none.
+func (imp Import) key() string {
+	if imp.Name != "" {
+		return imp.Name
+	}
+	return imp.Peer
+}
+
+// validate checks that every import has a peer and a name of its own.
+func (m Manifest) validate() error {
+	seen := make(map[string]bool)
+	for _, imp := range m.Imports {
+		if imp.Peer == "" {
+			return fmt.Errorf("eventbus: import without peer")
+		}
+		if seen[imp.key()] {
+			return fmt.Errorf("eventbus: duplicate import %q: give each import from a peer a name", imp.key())
+		}
+		seen[imp.key()] = true
+	}
+
+	return nil
+}
+
+// LoadManifest reads a JSON manifest from a file, and returns an error if
+// two imports share a name.
+func LoadManifest(path string) (Manifest, error) {
+	var m Manifest
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return m, err
+	}
+
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("eventbus: manifest %s: %w", path, err)
+	}
+	if err := m.validate(); err != nil {
+		return m, fmt.Errorf("eventbus: manifest %s: %w", path, err)
+	}
+
+	return m, nil
+}
+
+// exportLimit is the maximum number of events returned by an export request.
+const exportLimit = 1000
+
+// ExportHandler returns an HTTP handler serving the events of the topics
+// exported by m to the peers importing them.
+//
+// It answers GET requests with a JSON array of at most 1000 events, in log
+// order, selected by the optional "after" query parameter, an event ID, and
+// "topic" parameters, which can be repeated. Topics that m does not export
+// are never returned. An "after" ID that the bus does not know, see
+// CheckCursor, is answered with 410 Gone, rather than with no events.
+func (b *Bus) ExportHandler(m Manifest) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		params := r.URL.Query()
+		requested := params["topic"]
+
+		if err := b.CheckCursor(params.Get("after")); err != nil {
+			http.Error(w, err.Error(), http.StatusGone)
+			return
+		}
+
+		events := make([]Event, 0)
+		if len(m.Exports) == 0 {
+			// an empty Topics would select everything
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(events)
+			return
+		}
+
+		b.ForEachEvent(Query{Topics: m.Exports, AfterID: params.Get("after")}, func(e Event) {
+			if len(events) == exportLimit {
+				return
+			}
+			if len(requested) > 0 && !matchAny("", requested, e.Topic, matchTopic) {
+				return
+			}
+			events = append(events, e)
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(events)
+	})
+}
+
+// FederationConfig configures Federate.
+type FederationConfig struct {
+	// Client is used to reach peers. Nil means http.DefaultClient.
+	Client *http.Client
+
+	// Interval is the time between two polls of a peer.
+	// Zero defaults to one second.
+	Interval time.Duration
+
+	// Checkpoints, if not nil, stores how far each import got, under its
+	// name, so that a restarted bus does not import events twice.
+	Checkpoints CheckpointStore
+}
+
+// Federation copies the topics imported by a manifest from peers, until it
+// is closed.
+type Federation struct {
+	bus  *Bus
+	cfg  FederationConfig
+	stop chan struct{}
+	wg   sync.WaitGroup
+	once sync.Once
+
+	mu   sync.Mutex
+	errs map[string]error
+}
+
+// Federate starts copying the topics imported by m from their peers into the
+// bus. Imported events are appended without any concurrency check, with
+// their topic prefixed as the import says, and keep their type, payload and
+// timestamp; their payloads are the generic values decoded from JSON.
+//
+// Exports in m are not served by Federate: mount ExportHandler for them.
+func (b *Bus) Federate(m Manifest, cfg FederationConfig) (*Federation, error) {
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+
+	f := &Federation{
+		bus:  b,
+		cfg:  cfg,
+		stop: make(chan struct{}),
+		errs: make(map[string]error),
+	}
+
+	cursors := make([]string, len(m.Imports))
+	for i, imp := range m.Imports {
+		if cfg.Checkpoints != nil {
+			cp, err := cfg.Checkpoints.Load(imp.key())
+			if err != nil {
+				return nil, err
+			}
+			cursors[i] = cp.LastID
+		}
+	}
+
+	for i, imp := range m.Imports {
+		f.wg.Add(1)
+		go f.run(imp, cursors[i])
+	}
+
+	return f, nil
+}
+
+func (f *Federation) run(imp Import, cursor string) {
+	defer f.wg.Done()
+
+	ticker := time.NewTicker(f.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		var err error
+		cursor, err = f.pull(imp, cursor)
+
+		f.mu.Lock()
+		f.errs[imp.key()] = err
+		f.mu.Unlock()
+
+		select {
+		case <-ticker.C:
+		case <-f.stop:
+			return
+		}
+	}
+}
+
+// pull imports the events of a peer after cursor and returns the new cursor.
+func (f *Federation) pull(imp Import, cursor string) (string, error) {
+	for {
+		params := url.Values{"topic": imp.Topics}
+		if cursor != "" {
+			params.Set("after", cursor)
+		}
+
+		events, err := f.fetch(imp.Peer + "?" + params.Encode())
+		if err != nil {
+			return cursor, err
+		}
+
+		for _, e := range events {
+			_, err := f.bus.publishUnchecked(Event{
+				Topic:     imp.Prefix + e.Topic,
+				Type:      e.Type,
+				Payload:   e.Payload,
+				Timestamp: e.Timestamp,
+			})
+			if err != nil {
+				return cursor, err
+			}
+
+			cursor = e.ID
+			if f.cfg.Checkpoints != nil {
+				if err := f.cfg.Checkpoints.Save(imp.key(), Checkpoint{LastID: cursor}); err != nil {
+					return cursor, err
+				}
+			}
+		}
+
+		if len(events) < exportLimit {
+			return cursor, nil
+		}
+	}
+}
+
+func (f *Federation) fetch(u string) ([]Event, error) {
+	resp, err := f.cfg.Client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusGone {
+		// the peer does not know the cursor, such as after its log was
+		// rebuilt: importing cannot resume without help
+		return nil, fmt.Errorf("eventbus: import %s: %w", u, ErrUnknownCursor)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("eventbus: import %s: status %d", u, resp.StatusCode)
+	}
+
+	var events []Event
+	if err := json.NewDecoder(resp.Body).Decode(&events); err != nil {
+		return nil, fmt.Errorf("eventbus: import %s: %w", u, err)
+	}
+
+	return events, nil
+}
+
+// Errors returns the error of the last poll of each import that failed, by
+// import name, which is the peer URL for imports without a name. An import
+// whose cursor the peer no longer knows reports ErrUnknownCursor.
+func (f *Federation) Errors() map[string]error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	errs := make(map[string]error)
+	for peer, err := range f.errs {
+		if err != nil {
+			errs[peer] = err
+		}
+	}
+
+	return errs
+}
+
+// Close stops importing and waits for the polls in progress.
+func (f *Federation) Close() {
+	f.once.Do(func() { close(f.stop) })
+	f.wg.Wait()
+}
@@ -0,0 +1,160 @@
+package eventbus
+
+import "slices"
+
+// WithGroup makes the subscription a member of a consumer group. Each event
+// is delivered to a single member of the group, in turn, instead of to every
+// subscriber, so that several workers can share the load of one stream
+// without handling any event twice.
+//
+// An event goes to the next member whose query matches it and whose buffer
+// has room; it is only dropped when every matching member is full. Only the
+// first member of a group replays history from fromID, without dropping any
+// of it, and gets the events published meanwhile until it has caught up:
+// later members join the live stream. When a member closes its
+// subscription, the events still waiting in its buffer are handed over to
+// the remaining members, as well as the history it had yet to replay.
+//
+// The group keeps its position when its last member leaves: the next member
+// to join resumes after the last event the group was sent, whatever its
+// fromID, so that no event is handled twice.
+func WithGroup(name string) SubscribeOption {
+	return func(s *subscriber) {
+		s.group = name
+	}
+}
+
+// group is a set of subscribers that compete for events.
+type group struct {
+	members []*subscriber
+	next    int
+
+	// lastID is the position of the group, as of when its members left.
+	lastID string
+
+	// handing is set while the pump of a member that left has yet to stop
+	// and hand the rest of the history over.
+	handing bool
+}
+
+// deliver sends e to the next member that matches it and has room, without
+// blocking, and returns that member and true. If every matching member is
+// full, it returns the member e was dropped for and false, and if none
+// matches, nil and false. It must be called with the bus lock held.
+func (g *group) deliver(e Event) (*subscriber, bool) {
+	if g.handing {
+		// the member taking over the history gets e from the log in turn
+		return nil, false
+	}
+	for _, sub := range g.members {
+		if sub.pumping && sub.match(e) {
+			// the member replaying history gets e from the log in turn
+			return nil, false
+		}
+	}
+
+	var first *subscriber
+
+	for i := range len(g.members) {
+		idx := (g.next + i) % len(g.members)
+		sub := g.members[idx]
+		if sub.paused || !sub.match(e) {
+			continue
+		}
+		if first == nil {
+			first = sub
+		}
+
+		select {
+		case sub.ch <- e:
+			sub.sent(e)
+			g.next = (idx + 1) % len(g.members)
+			return sub, true
+		default:
+		}
+	}
+
+	if first != nil {
+		first.drop(e)
+	}
+	return first, false
+}
+
+// join adds sub to its group and reports whether sub must replay history,
+// and from which position: from its fromID for a new group, or from the
+// position of a group without members. It must be called with b.mu held.
+func (b *Bus) join(sub *subscriber) (string, bool) {
+	g, ok := b.groups[sub.group]
+	if !ok {
+		g = &group{}
+		b.groups[sub.group] = g
+	}
+	g.members = append(g.members, sub)
+
+	switch {
+	case !ok:
+		return sub.query.AfterID, true
+	case len(g.members) == 1 && !g.handing:
+		return g.lastID, true
+	default:
+		// a pump that has yet to stop hands its history over, see handOver
+		return "", false
+	}
+}
+
+// leave removes sub from its group and hands the events left in its buffer
+// over to the remaining members. If sub was replaying history, its pump
+// hands the rest over when it stops, otherwise leave records the position of
+// the group. It must be called with b.mu held.
+func (b *Bus) leave(sub *subscriber) {
+	g := b.groups[sub.group]
+	if g == nil {
+		return
+	}
+
+	g.members = slices.DeleteFunc(g.members, func(s *subscriber) bool { return s == sub })
+	if len(g.members) > 0 {
+		g.next %= len(g.members)
+		for drained := false; !drained; {
+			select {
+			case e := <-sub.ch:
+				g.deliver(e)
+			default:
+				drained = true
+			}
+		}
+	}
+
+	if sub.pumping {
+		g.handing = true
+		return
+	}
+	if seqOf(sub.lastID) > seqOf(g.lastID) {
+		g.lastID = sub.lastID
+	}
+}
+
+// handOver records the position of the group of sub, a member whose pump
+// stopped after it left, and lets another member replay the history sub had
+// yet to. It must be called with b.mu held.
+func (b *Bus) handOver(sub *subscriber) {
+	g := b.groups[sub.group]
+	if g == nil {
+		return
+	}
+
+	g.handing = false
+	if seqOf(sub.lastID) > seqOf(g.lastID) {
+		g.lastID = sub.lastID
+	}
+	if len(g.members) == 0 {
+		return
+	}
+
+	next := g.members[g.next]
+	if !next.pumping && !next.paused {
+		next.lastID = sub.lastID
+		next.pumping = true
+		go b.pump(next)
+	}
+}
@@ -0,0 +1,557 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Handler consumes events from the bus by calling a function for each of
+// them in its own goroutine, and records how that went.
+type Handler struct {
+	bus  *Bus
+	name string
+	q    Query
+	sub  *Subscription
+	fn   func(Event) error
+	done chan struct{}
+	stop chan struct{}
+	once sync.Once
+
+	checkpoints CheckpointStore
+	cp          Checkpoint
+
+	deadLetter  string
+	maxFailures int
+	retry       *RetryPolicy
+
+	priority int
+
+	mu    sync.Mutex
+	stats HandlerStats
+}
+
+// HandlerOption configures a Handler.
+type HandlerOption func(*Handler)
+
+// WithCheckpoints makes the handler resume from the checkpoint saved under its
+// name in store, instead of q.AfterID, and save a new checkpoint after each
+// event.
+func WithCheckpoints(store CheckpointStore) HandlerOption {
+	return func(h *Handler) {
+		h.checkpoints = store
+	}
+}
+
+// WithDeadLetter makes the handler retry an event that fails until it has
+// failed maxFailures times, then publish it to the topic as a DeadLetter and
+// move on.
+//
+// Combined with WithCheckpoints, attempts are recorded before calling the
+// function, so an event that crashes the process is also diverted once it has
+// been attempted maxFailures times across restarts.
+//
+// If the bus refuses the dead letter, such as when a validator vetoes it or
+// the store fails, the handler counts a DeadLetterError and tries again every
+// second, without moving on, so that the event is never lost. If the bus or
+// the handler is closed meanwhile, the event stays pending for the next run.
+func WithDeadLetter(topic string, maxFailures int) HandlerOption {
+	return func(h *Handler) {
+		h.deadLetter = topic
+		h.maxFailures = max(maxFailures, 1)
+	}
+}
+
+// attempts returns the number of calls made for an event before giving up on
+// it.
+func (h *Handler) attempts() int {
+	switch {
+	case h.retry != nil && h.retry.MaxAttempts > 0:
+		return h.retry.MaxAttempts
+	case h.deadLetter != "":
+		return h.maxFailures
+	case h.retry != nil:
+		return 3
+	default:
+		return 1
+	}
+}
+
+// RetryPolicy describes how a handler retries an event when its function
+// returns an error or panics.
+type RetryPolicy struct {
+	// MaxAttempts is the number of calls made for an event before giving up
+	// on it, including the first one. Zero means the maxFailures given to
+	// WithDeadLetter, or 3 without a dead-letter topic.
+	MaxAttempts int
+
+	// Backoff is the delay before the first retry. It doubles after each
+	// retry, up to MaxBackoff if it is set.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// Jitter randomly shortens each delay by up to this fraction, between 0
+	// and 1, so that handlers failing together do not retry together.
+	Jitter float64
+}
+
+// delay returns the time to wait before the given retry, starting at 1.
+func (p RetryPolicy) delay(retry int) time.Duration {
+	d := p.Backoff
+	for range retry - 1 {
+		if p.MaxBackoff > 0 && d >= p.MaxBackoff {
+			break
+		}
+		d *= 2
+	}
+	if p.MaxBackoff > 0 {
+		d = min(d, p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d -= time.Duration(float64(d) * min(p.Jitter, 1) * rand.Float64())
+	}
+	return d
+}
+
+// WithRetry makes the handler retry an event that fails, waiting between
+// attempts as p describes. Once the attempts are exhausted, the event is
+// diverted to the dead-letter topic if the handler has one, and counted as
+// failed otherwise.
+func WithRetry(p RetryPolicy) HandlerOption {
+	return func(h *Handler) {
+		h.retry = &p
+	}
+}
+
+// WithHandlerPriority sets the shutdown priority of the handler's
+// subscription, like WithShutdownPriority. Shutdown waits for the handler to
+// process its last event before closing subscriptions of higher priority.
+func WithHandlerPriority(p int) HandlerOption {
+	return func(h *Handler) {
+		h.priority = p
+	}
+}
+
+// DeadLetterType is the event type of the events published on dead-letter
+// topics.
+const DeadLetterType = "dead_letter"
+
+// DeadLetter is the payload of an event diverted to a dead-letter topic.
+type DeadLetter struct {
+	Handler  string `json:"handler"`
+	Event    Event  `json:"event"`
+	Error    string `json:"error"`
+	Attempts int    `json:"attempts"`
+}
+
+// errIncomplete is reported for attempts that never returned, because the
+// process stopped while the handler was processing the event.
+var errIncomplete = errors.New("eventbus: handler did not complete")
+
+// HandlerStats reports the outcome of the events processed by a Handler.
+type HandlerStats struct {
+	Name string
+
+	// Succeeded counts the events for which the function returned nil.
+	Succeeded uint64
+
+	// Failed counts the events for which the function returned an error or
+	// panicked, after any retry.
+	Failed uint64
+
+	// Retried counts the extra calls made for events that failed before.
+	Retried uint64
+
+	// DeadLettered counts the failed events published to the dead-letter
+	// topic.
+	DeadLettered uint64
+
+	// DeadLetterErrors counts the attempts to publish a dead letter that the
+	// bus refused.
+	DeadLetterErrors uint64
+
+	// CheckpointErrors counts the checkpoints that could not be saved.
+	CheckpointErrors uint64
+
+	// TotalLatency is the time spent in the function, summed over all events.
+	TotalLatency time.Duration
+
+	// MaxLatency is the longest time spent in the function for a single event.
+	MaxLatency time.Duration
+}
+
+// Processed returns the number of events the handler has processed.
+func (s HandlerStats) Processed() uint64 {
+	return s.Succeeded + s.Failed
+}
+
+// AvgLatency returns the average time spent in the function per call.
+func (s HandlerStats) AvgLatency() time.Duration {
+	n := s.Processed() + s.Retried
+	if n == 0 {
+		return 0
+	}
+	return s.TotalLatency / time.Duration(n)
+}
+
+// Handle starts a handler named name that calls fn for each event matching q.
+//
+// Events are replayed from q.AfterID, then delivered live, exactly like a
+// subscription, and fn is called for one event at a time. If the handler
+// falls behind and live events are dropped, it resubscribes from the last
+// event it processed, so that none is skipped. If fn returns an error or
+// panics, the event is counted as failed and the handler moves on to the
+// next one, unless options say otherwise.
+//
+// The handler runs until Close is called on it or on the bus.
+func (b *Bus) Handle(name string, q Query, fn func(Event) error, opts ...HandlerOption) (*Handler, error) {
+	h := &Handler{
+		bus:   b,
+		name:  name,
+		fn:    fn,
+		done:  make(chan struct{}),
+		stop:  make(chan struct{}),
+		stats: HandlerStats{Name: name},
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	fromID := q.AfterID
+	if h.checkpoints != nil {
+		cp, err := h.checkpoints.Load(name)
+		if err != nil {
+			return nil, err
+		}
+		h.cp = cp
+		if cp.LastID != "" {
+			fromID = cp.LastID
+		}
+	}
+
+	q.AfterID = fromID
+	h.q = q
+
+	sub, err := b.SubscribeQuery(q, h.options()...)
+	if err != nil {
+		return nil, err
+	}
+	h.sub = sub
+
+	b.mu.Lock()
+	b.handlers[h] = struct{}{}
+	b.mu.Unlock()
+
+	go h.run()
+
+	return h, nil
+}
+
+// ProcessFrom runs the complete loop of a consumer named name, and blocks
+// until ctx is done or the bus is closed.
+//
+// It resumes after the checkpoint saved under name in store, or from
+// q.AfterID the first time, replays history in log order, switches to live
+// events without gap, and saves a checkpoint after each event, like a
+// handler started with Handle and WithCheckpoints. When ctx is done, it waits
+// for the event being processed and returns nil; if the bus is closed, it
+// returns ErrClosed.
+func (b *Bus) ProcessFrom(ctx context.Context, name string, q Query, store CheckpointStore, fn func(Event) error, opts ...HandlerOption) error {
+	h, err := b.Handle(name, q, fn, append(opts, WithCheckpoints(store))...)
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-h.done:
+		return ErrClosed
+	}
+}
+
+func (h *Handler) run() {
+	defer close(h.done)
+
+	for {
+		select {
+		case <-h.stop:
+			h.sub.Close()
+			return
+		default:
+		}
+
+		select {
+		case e, ok := <-h.sub.C:
+			if !ok {
+				return
+			}
+			if h.sub.Dropped() > 0 {
+				// e may come after a gap: replay from the last event processed
+				if !h.resubscribe() {
+					return
+				}
+				continue
+			}
+			h.process(e)
+
+		case <-h.stop:
+			h.sub.Close()
+			return
+		}
+	}
+}
+
+// resubscribe replaces the subscription with one starting after the last
+// event processed. It reports false if the bus is closed.
+func (h *Handler) resubscribe() bool {
+	h.sub.Close()
+
+	q := h.q
+	if h.cp.LastID != "" {
+		q.AfterID = h.cp.LastID
+	}
+
+	sub, err := h.bus.SubscribeQuery(q, h.options()...)
+	if err != nil {
+		return false
+	}
+	h.sub = sub
+
+	return true
+}
+
+// options returns the options of the handler's subscriptions.
+func (h *Handler) options() []SubscribeOption {
+	return []SubscribeOption{
+		WithName(h.name),
+		WithShutdownPriority(h.priority),
+		func(s *subscriber) { s.finished = h.done },
+	}
+}
+
+// process calls fn for e, retrying and dead-lettering as configured, and
+// checkpoints the outcome.
+func (h *Handler) process(e Event) {
+	attempts := 0
+	var err error
+	if h.cp.PendingID != "" && h.cp.PendingID == e.ID {
+		// a previous run stopped while processing this event
+		attempts = h.cp.Attempts
+		err = errIncomplete
+	}
+
+	limit := h.attempts()
+
+	for {
+		if attempts >= limit {
+			if h.deadLetter == "" {
+				h.count(func(s *HandlerStats) { s.Failed++ })
+				break
+			}
+			if !h.bury(e, err, attempts) {
+				// closing: the checkpoint leaves the event pending
+				return
+			}
+			break
+		}
+
+		if attempts > 0 {
+			if h.retry != nil && !h.sleep(h.retry.delay(attempts)) {
+				// closing: leave the event to the next run
+				return
+			}
+			h.count(func(s *HandlerStats) { s.Retried++ })
+		}
+		attempts++
+
+		if h.deadLetter != "" {
+			h.checkpoint(Checkpoint{LastID: h.cp.LastID, PendingID: e.ID, Attempts: attempts})
+		}
+
+		start := time.Now()
+		err = h.call(e)
+		elapsed := time.Since(start)
+
+		h.count(func(s *HandlerStats) {
+			s.TotalLatency += elapsed
+			s.MaxLatency = max(s.MaxLatency, elapsed)
+		})
+
+		if err == nil {
+			h.count(func(s *HandlerStats) { s.Succeeded++ })
+			break
+		}
+	}
+
+	if e.ID != "" {
+		h.checkpoint(Checkpoint{LastID: e.ID})
+	}
+}
+
+// sleep waits for d and reports false if the handler is closed before.
+func (h *Handler) sleep(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-h.stop:
+		return false
+	}
+}
+
+// buryRetry is the time after which a dead letter the bus refused is
+// published again.
+const buryRetry = time.Second
+
+// bury publishes e to the dead-letter topic, trying again while the bus
+// refuses it, and reports false if the bus or the handler is closed before
+// it succeeds.
+func (h *Handler) bury(e Event, err error, attempts int) bool {
+	dl := DeadLetter{
+		Handler:  h.name,
+		Event:    e,
+		Attempts: attempts,
+	}
+	if err != nil {
+		dl.Error = err.Error()
+	}
+
+	for {
+		_, err := h.bus.publishUnchecked(Event{Topic: h.deadLetter, Type: DeadLetterType, Payload: dl})
+		if err == nil {
+			break
+		}
+
+		h.count(func(s *HandlerStats) { s.DeadLetterErrors++ })
+		if errors.Is(err, ErrClosed) || !h.sleep(buryRetry) {
+			return false
+		}
+	}
+
+	h.count(func(s *HandlerStats) {
+		s.Failed++
+		s.DeadLettered++
+	})
+	return true
+}
+
+// checkpoint records cp and saves it if the handler has a store.
+func (h *Handler) checkpoint(cp Checkpoint) {
+	h.cp = cp
+	if h.checkpoints == nil {
+		return
+	}
+
+	if err := h.checkpoints.Save(h.name, cp); err != nil {
+		h.count(func(s *HandlerStats) { s.CheckpointErrors++ })
+	}
+}
+
+// count updates the handler's statistics.
+func (h *Handler) count(fn func(*HandlerStats)) {
+	h.mu.Lock()
+	fn(&h.stats)
+	h.mu.Unlock()
+}
+
+// call runs fn and turns a panic into an error.
+func (h *Handler) call(e Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("eventbus: handler panic: %v", r)
+		}
+	}()
+
+	return h.fn(e)
+}
+
+// Stats returns a snapshot of the handler's statistics.
+func (h *Handler) Stats() HandlerStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.stats
+}
+
+// Close stops the handler and waits for the event being processed, if any.
+// An event waiting to be retried is abandoned; with checkpoints, the next run
+// of the handler starts with it.
+func (h *Handler) Close() {
+	h.once.Do(func() { close(h.stop) })
+	<-h.done
+
+	h.bus.mu.Lock()
+	delete(h.bus.handlers, h)
+	h.bus.mu.Unlock()
+}
+
+// HandlerStats returns the statistics of every running handler, so that slow
+// or failing consumers can be spotted.
+func (b *Bus) HandlerStats() []HandlerStats {
+	b.mu.RLock()
+	handlers := make([]*Handler, 0, len(b.handlers))
+	for h := range b.handlers {
+		handlers = append(handlers, h)
+	}
+	b.mu.RUnlock()
+
+	stats := make([]HandlerStats, 0, len(handlers))
+	for _, h := range handlers {
+		stats = append(stats, h.Stats())
+	}
+
+	slices.SortFunc(stats, func(a, b HandlerStats) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return stats
+}
+
+// HandlerVars returns an expvar.Var reporting the statistics of every running
+// handler, by name, for metrics exporters that read expvar:
+//
+//	expvar.Publish("eventbus_handlers", bus.HandlerVars())
+//
+// Latencies are in seconds.
+func (b *Bus) HandlerVars() expvar.Var {
+	type handlerVar struct {
+		Succeeded        uint64  `json:"succeeded"`
+		Failed           uint64  `json:"failed"`
+		Retried          uint64  `json:"retried"`
+		DeadLettered     uint64  `json:"dead_lettered"`
+		DeadLetterErrors uint64  `json:"dead_letter_errors"`
+		CheckpointErrors uint64  `json:"checkpoint_errors"`
+		TotalLatency     float64 `json:"total_latency"`
+		AvgLatency       float64 `json:"avg_latency"`
+		MaxLatency       float64 `json:"max_latency"`
+	}
+
+	return expvar.Func(func() any {
+		vars := make(map[string]handlerVar)
+		for _, s := range b.HandlerStats() {
+			vars[s.Name] = handlerVar{
+				Succeeded:        s.Succeeded,
+				Failed:           s.Failed,
+				Retried:          s.Retried,
+				DeadLettered:     s.DeadLettered,
+				DeadLetterErrors: s.DeadLetterErrors,
+				CheckpointErrors: s.CheckpointErrors,
+				TotalLatency:     s.TotalLatency.Seconds(),
+				AvgLatency:       s.AvgLatency().Seconds(),
+				MaxLatency:       s.MaxLatency.Seconds(),
+			}
+		}
+		return vars
+	})
+}
@@ -0,0 +1,74 @@
+package eventbus
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+// InvalidationRule maps the events matching Query to the cache keys they make
+// stale, such as "/accounts/42" for a "Deposited" event on "account-42".
+// Query.AfterID is ignored.
+type InvalidationRule struct {
+	Query Query
+	Keys  func(Event) []string
+}
+
+// InvalidateCache starts a handler named name that calls invalidate with the
+// cache keys of each new event, according to rules, so that web layers can
+// keep their caches coherent with the log.
+//
+// Only events published after the call are considered. Keys from every
+// matching rule are deduplicated and passed in a single call; events matching
+// no rule are skipped. An error from invalidate is handled like any handler
+// error, so opts such as WithDeadLetter apply.
+func (b *Bus) InvalidateCache(name string, rules []InvalidationRule, invalidate func(keys []string) error, opts ...HandlerOption) (*Handler, error) {
+	q := Query{Topic: AllTopics, AfterID: b.End()}
+
+	return b.Handle(name, q, func(e Event) error {
+		var keys []string
+		for _, r := range rules {
+			if r.Query.match(e) {
+				keys = append(keys, r.Keys(e)...)
+			}
+		}
+
+		slices.Sort(keys)
+		keys = slices.Compact(keys)
+		if len(keys) == 0 {
+			return nil
+		}
+
+		return invalidate(keys)
+	}, opts...)
+}
+
+// HTTPPurger returns an invalidation function for InvalidateCache that sends
+// an HTTP PURGE request to urlFor(key) for each key, as understood by caching
+// proxies such as Varnish. A nil client uses http.DefaultClient.
+func HTTPPurger(client *http.Client, urlFor func(key string) string) func(keys []string) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return func(keys []string) error {
+		for _, key := range keys {
+			req, err := http.NewRequest("PURGE", urlFor(key), nil)
+			if err != nil {
+				return err
+			}
+
+			resp, err := client.Do(req)
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode >= 300 {
+				return fmt.Errorf("eventbus: purge %s: status %d", key, resp.StatusCode)
+			}
+		}
+
+		return nil
+	}
+}
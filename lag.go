@@ -0,0 +1,92 @@
+package eventbus
+
+import (
+	"cmp"
+	"slices"
+)
+
+// SubscriberLag describes how far a subscriber is behind the log.
+type SubscriberLag struct {
+	// ID and Name identify the subscriber, see Subscription.ID and
+	// WithName.
+	ID    uint64
+	Name  string
+	Query Query
+
+	// LastID is the ID of the last stored event sent to the subscriber, or
+	// the position it started from.
+	LastID string
+
+	// Buffered is the number of events waiting in the subscriber's channel.
+	Buffered int
+
+	// Behind is the number of stored events matching the subscriber after
+	// LastID, which it has not been sent because it was paused or its buffer
+	// was full. It is always 0 for members of a consumer group, which share
+	// the stream with the rest of the group.
+	Behind int
+
+	// Dropped is the number of events dropped for the subscriber.
+	Dropped uint64
+}
+
+// Lag returns the number of events the subscriber still has to go through
+// to reach the head of the log: the ones waiting in its channel and the ones
+// it missed after the last one it was sent.
+func (l SubscriberLag) Lag() int {
+	return l.Buffered + l.Behind
+}
+
+// Lag returns the number of events between the subscription and the head of
+// the log, as described on SubscriberLag.Lag. A growing lag means the
+// consumer is falling behind and will soon drop events.
+func (s *Subscription) Lag() int {
+	s.bus.mu.RLock()
+	defer s.bus.mu.RUnlock()
+
+	return s.bus.lag(s.sub).Lag()
+}
+
+// SubscriberLags returns the lag of every subscriber of the bus, most lagging
+// first, so that operators can spot projections falling behind.
+func (b *Bus) SubscriberLags() []SubscriberLag {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	lags := make([]SubscriberLag, 0, len(b.subscribers))
+	for sub := range b.subscribers {
+		lags = append(lags, b.lag(sub))
+	}
+
+	slices.SortStableFunc(lags, func(a, b SubscriberLag) int {
+		return cmp.Compare(b.Lag(), a.Lag())
+	})
+
+	return lags
+}
+
+// lag measures how far sub is behind. It must be called with b.mu held.
+func (b *Bus) lag(sub *subscriber) SubscriberLag {
+	l := SubscriberLag{
+		ID:       sub.id,
+		Name:     sub.name,
+		Query:    sub.query,
+		LastID:   sub.lastID,
+		Buffered: len(sub.ch),
+		Dropped:  sub.dropped.Load(),
+	}
+
+	if sub.group != "" {
+		return l
+	}
+
+	if start, ok, _ := b.start(sub.lastID); ok {
+		b.scan(start, len(b.events), sub.query, func(e Event) {
+			if sub.match(e) {
+				l.Behind++
+			}
+		})
+	}
+
+	return l
+}
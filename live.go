@@ -0,0 +1,120 @@
+package eventbus
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Live keeps a small read model up to date from the events matching a query,
+// and serves it as an HTML fragment over server-sent events, re-rendered on
+// every change. It is the glue needed for live dashboards such as kitchen
+// orders or account balances.
+type Live[S any] struct {
+	apply  func(S, Event) S
+	render func(io.Writer, S) error
+
+	mu      sync.Mutex
+	state   S
+	changed chan struct{}
+
+	handler *Handler
+}
+
+// NewLive starts a live read model named name, built by folding apply over
+// the events matching q, starting from initial. render writes the HTML
+// fragment for a state, for instance with html/template:
+//
+//	func(w io.Writer, s Orders) error { return tmpl.Execute(w, s) }
+//
+// Events are replayed from q.AfterID before following live ones, so the
+// read model is complete from the start.
+func NewLive[S any](b *Bus, name string, q Query, initial S, apply func(S, Event) S, render func(io.Writer, S) error) (*Live[S], error) {
+	l := &Live[S]{
+		apply:   apply,
+		render:  render,
+		state:   initial,
+		changed: make(chan struct{}),
+	}
+
+	h, err := b.Handle(name, q, func(e Event) error {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		l.state = l.apply(l.state, e)
+
+		// wake up every stream waiting for a change
+		close(l.changed)
+		l.changed = make(chan struct{})
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	l.handler = h
+
+	return l, nil
+}
+
+// State returns the current state of the read model.
+func (l *Live[S]) State() S {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.state
+}
+
+// snapshot returns the current state and a channel closed on the next change.
+func (l *Live[S]) snapshot() (S, <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.state, l.changed
+}
+
+// ServeHTTP streams the rendered fragment as server-sent events: once when the
+// client connects, then after each change. Changes that happen while a
+// fragment is being sent are coalesced into the next one.
+func (l *Live[S]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	var buf bytes.Buffer
+	for {
+		state, changed := l.snapshot()
+
+		buf.Reset()
+		if err := l.render(&buf, state); err != nil {
+			return
+		}
+
+		// each line of the fragment needs its own data field
+		for line := range strings.SplitSeq(strings.TrimRight(buf.String(), "\n"), "\n") {
+			fmt.Fprintf(w, "data: %s\n", line)
+		}
+		fmt.Fprint(w, "\n")
+		flusher.Flush()
+
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// Close stops updating the read model. Open streams keep their connection
+// but receive no more changes.
+func (l *Live[S]) Close() {
+	l.handler.Close()
+}
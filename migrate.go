@@ -0,0 +1,336 @@
+package eventbus
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Backend is a place where a whole bus can be persisted, such as a file or a
+// remote server. It is what Migrate copies between.
+type Backend interface {
+	// Load reads the persisted log into a new bus. The bus is frozen, so
+	// that scheduled events stay pending until Unfreeze is called.
+	Load() (*Bus, error)
+
+	// Save persists the whole log of the bus, replacing what was there.
+	Save(b *Bus) error
+}
+
+// FileBackend is a Backend storing the bus as a JSON file, with SaveToFile
+// and LoadFromFile.
+type FileBackend string
+
+// Load implements Backend. Unlike NewFromFile, it returns an error if the
+// file does not exist.
+func (f FileBackend) Load() (*Bus, error) {
+	b := newFrozen()
+	if err := b.LoadFromFile(string(f)); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Save implements Backend.
+func (f FileBackend) Save(b *Bus) error {
+	return b.SaveToFile(string(f))
+}
+
+// StoreBackend is a Backend keeping the log in a Store, such as a WAL or a
+// sqlitestore.Store, to move a dumped log to a store or back.
+//
+// Stores are append-only and do not hold scheduled events: Save returns an
+// error if the store is not empty or if the bus has scheduled events
+// pending, rather than losing them.
+type StoreBackend struct {
+	Store Store
+}
+
+// Load implements Backend. The bus holds a copy of the stored events, and
+// does not write to the store.
+func (s StoreBackend) Load() (*Bus, error) {
+	b, err := recoverStore(s.Store, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	b.Freeze()
+	return b, nil
+}
+
+// Save implements Backend.
+func (s StoreBackend) Save(b *Bus) error {
+	if n := s.Store.Len(); n > 0 {
+		return fmt.Errorf("eventbus: store already holds %d events", n)
+	}
+
+	view := b.Snapshot()
+	if len(view.scheduled) > 0 {
+		return fmt.Errorf("eventbus: store cannot hold %d scheduled events", len(view.scheduled))
+	}
+
+	return s.Store.Append(view.events...)
+}
+
+// WALBackend is a Backend storing the bus in a WAL file, as written by
+// OpenWAL.
+type WALBackend string
+
+// Load implements Backend. It returns an error if the file does not exist.
+func (w WALBackend) Load() (*Bus, error) {
+	if _, err := os.Stat(string(w)); err != nil {
+		return nil, err
+	}
+
+	wal, err := OpenWAL(string(w), SyncOnClose, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer wal.Close()
+
+	return StoreBackend{wal}.Load()
+}
+
+// Save implements Backend. The file is replaced atomically, as with
+// SaveToFile, and Save returns an error if the bus has scheduled events
+// pending, which a WAL cannot hold.
+func (w WALBackend) Save(b *Bus) error {
+	view := b.Snapshot()
+	if len(view.scheduled) > 0 {
+		return fmt.Errorf("eventbus: store cannot hold %d scheduled events", len(view.scheduled))
+	}
+
+	return writeFileAtomic(string(w), false, view.DumpNDJSON)
+}
+
+// HTTPBackend is a Backend storing the bus on a remote server, which returns
+// the dump on GET and replaces it on PUT.
+//
+// Dumps can be compressed with any registered Codec. On GET, the backend
+// advertises all registered codecs in Accept-Encoding and decodes whatever
+// Content-Encoding the server picked. On PUT, it compresses with Codec, if
+// set, and falls back to an uncompressed upload if the server refuses the
+// encoding with 415 Unsupported Media Type.
+type HTTPBackend struct {
+	Client *http.Client
+	URL    string
+
+	// Codec is the name of the registered codec used to compress uploads.
+	// Leave empty to send uncompressed dumps.
+	Codec string
+
+	// Stats, if not nil, counts the bytes transferred and saved by
+	// compression.
+	Stats *TransferStats
+}
+
+func (h HTTPBackend) client() *http.Client {
+	if h.Client == nil {
+		return http.DefaultClient
+	}
+	return h.Client
+}
+
+// Load implements Backend.
+func (h HTTPBackend) Load() (*Bus, error) {
+	req, err := http.NewRequest(http.MethodGet, h.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Setting Accept-Encoding also stops the transport from transparently
+	// decompressing gzip, so the codecs below see the raw body.
+	req.Header.Set("Accept-Encoding", codecNames())
+
+	resp, err := h.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("eventbus: load %s: status %d: %s", h.URL, resp.StatusCode, body)
+	}
+
+	wire := &countingReader{r: resp.Body}
+	raw := &countingReader{r: wire}
+
+	if enc := resp.Header.Get("Content-Encoding"); enc != "" && enc != "identity" {
+		c, ok := LookupCodec(enc)
+		if !ok {
+			return nil, fmt.Errorf("eventbus: load %s: unknown content encoding %q", h.URL, enc)
+		}
+		dec, err := c.NewReader(wire)
+		if err != nil {
+			return nil, fmt.Errorf("eventbus: load %s: %w", h.URL, err)
+		}
+		defer dec.Close()
+		raw.r = dec
+	}
+
+	b := newFrozen()
+	if err := b.Load(raw); err != nil {
+		return nil, err
+	}
+	h.Stats.add(raw.n, wire.n)
+
+	return b, nil
+}
+
+// Save implements Backend. A server that answers a compressed upload with
+// 415 Unsupported Media Type is sent the dump again uncompressed.
+func (h HTTPBackend) Save(b *Bus) error {
+	var raw bytes.Buffer
+	if err := b.Dump(&raw); err != nil {
+		return err
+	}
+
+	body, encoding := &raw, ""
+	if h.Codec != "" && h.Codec != "identity" {
+		c, ok := LookupCodec(h.Codec)
+		if !ok {
+			return fmt.Errorf("eventbus: save %s: unknown codec %q", h.URL, h.Codec)
+		}
+
+		compressed := new(bytes.Buffer)
+		w, err := c.NewWriter(compressed)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(raw.Bytes()); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+
+		body, encoding = compressed, c.Name()
+	}
+
+	status, err := h.put(body.Bytes(), encoding)
+	if encoding != "" && status == http.StatusUnsupportedMediaType {
+		body = &raw
+		_, err = h.put(body.Bytes(), "")
+	}
+	if err != nil {
+		return err
+	}
+	h.Stats.add(raw.Len(), body.Len())
+
+	return nil
+}
+
+// put uploads data with the given Content-Encoding, none if empty, and
+// returns the status of the response.
+func (h HTTPBackend) put(data []byte, encoding string) (int, error) {
+	req, err := http.NewRequest(http.MethodPut, h.URL, bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+
+	resp, err := h.client().Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, fmt.Errorf("eventbus: save %s: status %d: %s", h.URL, resp.StatusCode, body)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// newFrozen returns a new frozen bus, so that loading it does not publish
+// the scheduled events that are due.
+func newFrozen() *Bus {
+	b := New()
+	b.Freeze()
+	return b
+}
+
+// ParseBackend returns an HTTPBackend for http and https URLs, a WALBackend
+// for paths ending in .wal, and a FileBackend otherwise.
+//
+// SQLite databases need a database/sql driver, which this module does not
+// import: wrap a sqlitestore.Store in a StoreBackend to migrate to one.
+func ParseBackend(s string) Backend {
+	if strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://") {
+		return HTTPBackend{URL: s}
+	}
+	if strings.HasSuffix(s, ".wal") {
+		return WALBackend(s)
+	}
+	return FileBackend(s)
+}
+
+// TopicHead summarizes a topic: the number of events it has in the log and
+// the ID of the last one.
+type TopicHead struct {
+	Events int
+	LastID string
+}
+
+// MigrationReport describes what Migrate copied.
+type MigrationReport struct {
+	Events int
+	Topics map[string]TopicHead
+}
+
+// Migrate copies the log persisted in src to dst, then loads it back from dst
+// and checks that the number of events and the head of every topic are the
+// same on both sides.
+//
+// Migrate replaces whatever dst held before. It returns a report of what was
+// copied, along with an error if verification failed.
+func Migrate(dst, src Backend) (MigrationReport, error) {
+	b, err := src.Load()
+	if err != nil {
+		return MigrationReport{}, fmt.Errorf("eventbus: migrate: load source: %w", err)
+	}
+	defer b.Close()
+
+	report := summarize(b)
+
+	if err := dst.Save(b); err != nil {
+		return report, fmt.Errorf("eventbus: migrate: save destination: %w", err)
+	}
+
+	copied, err := dst.Load()
+	if err != nil {
+		return report, fmt.Errorf("eventbus: migrate: verify destination: %w", err)
+	}
+	defer copied.Close()
+
+	got := summarize(copied)
+	if got.Events != report.Events {
+		return report, fmt.Errorf("eventbus: migrate: destination has %d events, want %d", got.Events, report.Events)
+	}
+	for _, topic := range slices.Sorted(maps.Keys(report.Topics)) {
+		if got.Topics[topic] != report.Topics[topic] {
+			return report, fmt.Errorf("eventbus: migrate: topic %q differs in destination", topic)
+		}
+	}
+
+	return report, nil
+}
+
+func summarize(b *Bus) MigrationReport {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return MigrationReport{
+		Events: len(b.events),
+		Topics: b.heads(),
+	}
+}
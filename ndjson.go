@@ -0,0 +1,95 @@
+package eventbus
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+)
+
+// DumpNDJSON writes the events of the log to w as newline-delimited JSON,
+// one event per line, as they are read, so that memory use does not grow
+// with the log. Unlike Dump, the output can be appended to and tailed, and it
+// is the format of WAL files. It does not include scheduled events, and is
+// written in clear even if the bus has a keyring.
+func (b *Bus) DumpNDJSON(w io.Writer) error {
+	return b.Snapshot().DumpNDJSON(w)
+}
+
+// DumpNDJSON writes the view as newline-delimited JSON to w, in the same
+// format as Bus.DumpNDJSON.
+func (v *View) DumpNDJSON(w io.Writer) error {
+	return writeNDJSON(w, v.events)
+}
+
+// LoadNDJSON reads newline-delimited JSON events from r, as written by
+// DumpNDJSON or a WAL, one line at a time, and replaces the current log like
+// Load does. Pending scheduled events are discarded, as the format does not
+// carry them. Events without a version get one, as with older dumps.
+func (b *Bus) LoadNDJSON(r io.Reader) error {
+	var d dump
+
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		// a WAL writes the events of a transaction as an array
+		var batch []Event
+		var err error
+		if raw[0] == '[' {
+			err = json.Unmarshal(raw, &batch)
+		} else {
+			batch = make([]Event, 1)
+			err = json.Unmarshal(raw, &batch[0])
+		}
+		if err != nil {
+			return err
+		}
+		d.Events = append(d.Events, batch...)
+	}
+
+	// give a version to events written without one
+	migrations[1](&d)
+
+	return b.restore(d)
+}
+
+// DumpSince writes the events after afterID to w as newline-delimited JSON,
+// so that a replica holding the log up to afterID only receives what it
+// misses, and can append it to its own copy. An empty afterID dumps the whole
+// log, like DumpNDJSON.
+//
+// DumpSince returns ErrNotFound if afterID is not in the log. Events after
+// afterID that were already trimmed are not part of the output.
+func (b *Bus) DumpSince(w io.Writer, afterID string) error {
+	return b.Snapshot().DumpSince(w, afterID)
+}
+
+// DumpSince writes the events of the view after afterID to w, in the same
+// format as Bus.DumpSince. Along with View.End, it tells a replica up to
+// which ID it is in sync.
+func (v *View) DumpSince(w io.Writer, afterID string) error {
+	start, ok := v.start(afterID)
+	if !ok {
+		return ErrNotFound
+	}
+
+	return writeNDJSON(w, v.events[start:])
+}
+
+// writeNDJSON encodes events to w, one per line.
+func writeNDJSON(w io.Writer, events []Event) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
@@ -0,0 +1,311 @@
+// Package pebblestore implements eventbus.Store on Pebble, an LSM key-value
+// store, for histories larger than memory:
+//
+//	db, err := pebble.Open("events", &pebble.Options{})
+//	...
+//	store, err := pebblestore.Open(db)
+//	...
+//	bus, err := eventbus.NewWithStoreSince(store, time.Now().AddDate(0, -1, 0))
+//
+// The bus then only keeps recent events in memory, and Events reads the
+// whole history from disk, one event at a time.
+//
+// Events are stored as JSON under their sequence number as a big-endian
+// uint64, so that the key order is the log order, and indexed by topic.
+// Payloads are recovered as generic JSON values, as with eventbus.Load.
+//
+// The package is a module of its own, so that the bus does not depend on
+// Pebble.
+package pebblestore
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/pebble/v2"
+	"github.com/lobre/eventbus"
+)
+
+// Keys are made of a prefix byte: events under 'e' and their sequence
+// number, the topic index under 't', the topic, a zero byte and the sequence
+// number, and the number of events under 'n'.
+const (
+	eventPrefix = 'e'
+	topicPrefix = 't'
+)
+
+var countKey = []byte{'n'}
+
+// Store is an eventbus.Store backed by a Pebble database.
+type Store struct {
+	db *pebble.DB
+
+	mu     sync.Mutex
+	lastID string
+	n      int
+}
+
+// Open returns a Store using db. The caller keeps ownership of db and closes
+// it after the bus.
+func Open(db *pebble.DB) (*Store, error) {
+	s := &Store{db: db}
+
+	value, closer, err := db.Get(countKey)
+	switch {
+	case err == pebble.ErrNotFound:
+	case err != nil:
+		return nil, fmt.Errorf("pebblestore: open: %w", err)
+	default:
+		s.n = int(binary.BigEndian.Uint64(value))
+		closer.Close()
+	}
+
+	it, err := db.NewIter(&pebble.IterOptions{LowerBound: []byte{eventPrefix}, UpperBound: []byte{eventPrefix + 1}})
+	if err != nil {
+		return nil, fmt.Errorf("pebblestore: open: %w", err)
+	}
+	defer it.Close()
+
+	if it.Last() {
+		s.lastID = strconv.FormatUint(seqOf(it.Key()), 10)
+	}
+	if err := it.Error(); err != nil {
+		return nil, fmt.Errorf("pebblestore: open: %w", err)
+	}
+
+	return s, nil
+}
+
+// Append implements eventbus.Store. Events are written in a single batch,
+// synced to disk.
+func (s *Store) Append(events ...eventbus.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	batch := s.db.NewBatch()
+	defer batch.Close()
+
+	for _, e := range events {
+		seq, err := strconv.ParseUint(e.ID, 10, 64)
+		if err != nil {
+			return fmt.Errorf("pebblestore: invalid id %q", e.ID)
+		}
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+
+		if err := batch.Set(eventKey(seq), data, nil); err != nil {
+			return err
+		}
+		if err := batch.Set(topicKey(e.Topic, seq), nil, nil); err != nil {
+			return err
+		}
+	}
+
+	n := binary.BigEndian.AppendUint64(nil, uint64(s.n+len(events)))
+	if err := batch.Set(countKey, n, nil); err != nil {
+		return err
+	}
+	if err := batch.Commit(pebble.Sync); err != nil {
+		return err
+	}
+
+	s.lastID = events[len(events)-1].ID
+	s.n += len(events)
+
+	return nil
+}
+
+// ReadAfter implements eventbus.Store.
+func (s *Store) ReadAfter(id string, fn func(eventbus.Event) error) error {
+	from, err := seqAfter(id)
+	if err != nil {
+		return err
+	}
+
+	it, err := s.db.NewIter(&pebble.IterOptions{LowerBound: eventKey(from), UpperBound: []byte{eventPrefix + 1}})
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+
+	for ok := it.First(); ok; ok = it.Next() {
+		var e eventbus.Event
+		if err := json.Unmarshal(it.Value(), &e); err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	return it.Error()
+}
+
+// LastID implements eventbus.Store.
+func (s *Store) LastID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lastID
+}
+
+// Len implements eventbus.Store.
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.n
+}
+
+// Events returns an iterator over the stored events that match q, read from
+// disk as the loop goes, including those the bus does not hold in memory:
+//
+//	for e, err := range store.Events(eventbus.Query{Topic: "orders"}) {
+//		if err != nil {
+//			...
+//		}
+//		...
+//	}
+//
+// A single topic is read from its index, and AfterID, BeforeID and Reverse
+// bound the keys read; the other filters of q are then applied to the
+// events, as well as Offset and Limit. Expired events are skipped. An error
+// ends the iteration.
+func (s *Store) Events(q eventbus.Query) iter.Seq2[eventbus.Event, error] {
+	return func(yield func(eventbus.Event, error) bool) {
+		from, err := seqAfter(q.AfterID)
+		if err != nil {
+			yield(eventbus.Event{}, err)
+			return
+		}
+		var to uint64
+		if q.BeforeID != "" {
+			if to, err = strconv.ParseUint(q.BeforeID, 10, 64); err != nil {
+				yield(eventbus.Event{}, fmt.Errorf("pebblestore: invalid id %q", q.BeforeID))
+				return
+			}
+			if to <= from {
+				return
+			}
+		}
+
+		// keys are read from the index of the topic if there is a single
+		// one, and from the events themselves otherwise
+		opts := &pebble.IterOptions{LowerBound: eventKey(from), UpperBound: []byte{eventPrefix + 1}}
+		if to > 0 {
+			opts.UpperBound = eventKey(to)
+		}
+		index := q.Topic != "" && q.Topic != eventbus.AllTopics && len(q.Topics) == 0 && !strings.Contains(q.Topic, "*")
+		if index {
+			opts.LowerBound = topicKey(q.Topic, from)
+			opts.UpperBound = append([]byte{topicPrefix}, q.Topic+"\x01"...)
+			if to > 0 {
+				opts.UpperBound = topicKey(q.Topic, to)
+			}
+		}
+
+		it, err := s.db.NewIter(opts)
+		if err != nil {
+			yield(eventbus.Event{}, err)
+			return
+		}
+		defer it.Close()
+
+		first, next := it.First, it.Next
+		if q.Reverse {
+			first, next = it.Last, it.Prev
+		}
+
+		now := time.Now()
+		skip := q.Offset
+		n := 0
+		for ok := first(); ok; ok = next() {
+			var e eventbus.Event
+			if index {
+				e, err = s.get(seqOf(it.Key()))
+			} else {
+				err = json.Unmarshal(it.Value(), &e)
+			}
+			if err != nil {
+				yield(eventbus.Event{}, err)
+				return
+			}
+
+			if !e.ExpiresAt.IsZero() && !now.Before(e.ExpiresAt) || !q.Match(e) {
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+
+			if !yield(e, nil) {
+				return
+			}
+			if n++; n == q.Limit {
+				return
+			}
+		}
+
+		if err := it.Error(); err != nil {
+			yield(eventbus.Event{}, err)
+		}
+	}
+}
+
+// get returns the event with sequence number seq.
+func (s *Store) get(seq uint64) (eventbus.Event, error) {
+	var e eventbus.Event
+
+	value, closer, err := s.db.Get(eventKey(seq))
+	if err != nil {
+		return e, err
+	}
+	defer closer.Close()
+
+	err = json.Unmarshal(value, &e)
+	return e, err
+}
+
+// eventKey returns the key of the event with sequence number seq.
+func eventKey(seq uint64) []byte {
+	return binary.BigEndian.AppendUint64([]byte{eventPrefix}, seq)
+}
+
+// topicKey returns the key indexing the event with sequence number seq
+// under its topic.
+func topicKey(topic string, seq uint64) []byte {
+	key := append([]byte{topicPrefix}, topic...)
+	return binary.BigEndian.AppendUint64(append(key, 0), seq)
+}
+
+// seqOf returns the sequence number at the end of a key.
+func seqOf(key []byte) uint64 {
+	return binary.BigEndian.Uint64(key[len(key)-8:])
+}
+
+// seqAfter returns the sequence number following the one of an event ID, or
+// 0 for the empty string.
+func seqAfter(id string) (uint64, error) {
+	if id == "" {
+		return 0, nil
+	}
+
+	seq, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("pebblestore: invalid id %q", id)
+	}
+	return seq + 1, nil
+}
@@ -0,0 +1,65 @@
+package eventbus
+
+import (
+	"fmt"
+	"slices"
+)
+
+// precommit is a listener registered with PreCommit.
+type precommit struct {
+	query Query
+	fn    func(Event) error
+}
+
+// PreCommit registers fn as a pre-commit listener for the events matching
+// q: fn is called synchronously with each matching event before it is
+// appended or delivered to any subscriber, and can veto it by returning an
+// error, which the publish call then returns wrapped with ErrVetoed. It
+// suits validation-style listeners, such as policy checks or audits, that
+// must observe events before downstream consumers do.
+//
+// Listeners are called in the order they were registered, while the bus
+// lock is held, so fn must be fast and must not call back into the bus. The
+// events they get have no ID or Version yet, and an event may still not be
+// appended after a listener saw it, when a later listener or another event
+// of the same transaction vetoes. Scheduled events vetoed when they are due
+// are discarded.
+//
+// The returned function unregisters the listener.
+func (b *Bus) PreCommit(q Query, fn func(Event) error) func() {
+	p := &precommit{query: q, fn: fn}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.precommits = append(b.precommits, p)
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		b.precommits = slices.DeleteFunc(b.precommits, func(other *precommit) bool {
+			return other == p
+		})
+	}
+}
+
+// admit checks that e can be committed: that it matches its schema and that
+// no pre-commit listener vetoes it. It must be called with b.mu held, right
+// before committing e.
+func (b *Bus) admit(e Event) error {
+	if err := b.enforce(e); err != nil {
+		return err
+	}
+
+	for _, p := range b.precommits {
+		if !p.query.match(e) {
+			continue
+		}
+		if err := p.fn(e); err != nil {
+			return fmt.Errorf("%w: %w", ErrVetoed, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package eventbus
+
+import (
+	"slices"
+	"time"
+)
+
+// Presence event types, published by Presence with the member as payload.
+const (
+	PresenceJoined    = "joined"
+	PresenceHeartbeat = "heartbeat"
+	PresenceLeft      = "left"
+)
+
+// Presence tracks which members, such as the users of a chat room, are
+// online, with events published on a dedicated topic.
+//
+// A member is online from Join until Leave, as long as it sends a Heartbeat
+// more often than the TTL: presence events expire after the TTL, so members
+// that go away without leaving drop out on their own, and Sweep eventually
+// removes their events from the log.
+type Presence struct {
+	bus   *Bus
+	topic string
+	ttl   time.Duration
+}
+
+// NewPresence returns a Presence tracking members on topic, where a member
+// without news for ttl is considered gone.
+func NewPresence(b *Bus, topic string, ttl time.Duration) *Presence {
+	return &Presence{bus: b, topic: topic, ttl: ttl}
+}
+
+// Topic returns the topic the presence events are published on, for
+// subscribing to joins and departures.
+func (p *Presence) Topic() string {
+	return p.topic
+}
+
+// Join marks member as online.
+func (p *Presence) Join(member string) error {
+	return p.publish(PresenceJoined, member)
+}
+
+// Heartbeat keeps member online for another TTL. A heartbeat from a member
+// that was not online counts as joining.
+func (p *Presence) Heartbeat(member string) error {
+	return p.publish(PresenceHeartbeat, member)
+}
+
+// Leave marks member as offline.
+func (p *Presence) Leave(member string) error {
+	return p.publish(PresenceLeft, member)
+}
+
+func (p *Presence) publish(eventType, member string) error {
+	if p.topic == "" {
+		return ErrNoTopic
+	}
+
+	now := time.Now().UTC()
+	_, err := p.bus.publishUnchecked(Event{
+		Topic:     p.topic,
+		Type:      eventType,
+		Payload:   member,
+		Timestamp: now,
+		ExpiresAt: now.Add(p.ttl),
+	})
+
+	return err
+}
+
+// Members returns the members currently online, sorted.
+func (p *Presence) Members() []string {
+	online := make(map[string]bool)
+
+	p.bus.ForEachEvent(Query{Topic: p.topic}, func(e Event) {
+		member, ok := e.Payload.(string)
+		if !ok {
+			return
+		}
+		online[member] = e.Type != PresenceLeft
+	})
+
+	members := make([]string, 0, len(online))
+	for member, ok := range online {
+		if ok {
+			members = append(members, member)
+		}
+	}
+	slices.Sort(members)
+
+	return members
+}
+
+// Online reports whether member is currently online.
+func (p *Presence) Online(member string) bool {
+	return slices.Contains(p.Members(), member)
+}
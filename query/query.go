@@ -0,0 +1,477 @@
+// Package query runs simple SQL-like statements over the log of an
+// eventbus.Bus, for ad-hoc reporting without writing Go code:
+//
+//	SELECT payload.category, count(*), sum(payload.amount)
+//	FROM "expenses"
+//	WHERE type == "expense_recorded" && payload.amount > 10
+//	GROUP BY payload.category
+//	ORDER BY sum(payload.amount) DESC
+//	LIMIT 10
+//
+// Every clause but SELECT is optional, and keywords are case-insensitive.
+// Columns and GROUP BY terms are expressions as described on eventbus.Expr,
+// such as topic or payload.address.city, or * for the id, topic, type,
+// version and payload of each event. The aggregates count, sum, avg, min and
+// max apply to the events of each group, and count(*) counts them. FROM
+// takes a topic or pattern as in eventbus.Query.Topic, quoted or not, and
+// selects every topic when absent. WHERE is an eventbus.Expr. ORDER BY
+// names one of the selected columns as written, followed by ASC or DESC.
+package query
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/lobre/eventbus"
+)
+
+// ErrSyntax is returned when a statement cannot be parsed.
+var ErrSyntax = errors.New("query: syntax error")
+
+// Result holds the rows returned by a statement, with one value per column,
+// as it would be decoded from JSON.
+type Result struct {
+	Columns []string
+	Rows    [][]any
+}
+
+// Run executes stmt over the events of b. The log is read lazily, as with
+// Bus.Events, so Run does not block publishers while it works.
+func Run(b *eventbus.Bus, stmt string) (*Result, error) {
+	s, err := parse(stmt)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string]*group)
+	var order []*group
+	for e := range b.Events(s.query) {
+		k, err := s.key(e)
+		if err != nil {
+			return nil, err
+		}
+
+		g, ok := groups[k]
+		if !ok {
+			g = s.group(e)
+			groups[k] = g
+			order = append(order, g)
+		}
+		g.add(e)
+
+		if !s.grouped && len(order) == s.limit && s.order < 0 {
+			break
+		}
+	}
+
+	if s.grouped && len(order) == 0 && len(s.by) == 0 {
+		// aggregates over no events still return a row
+		order = append(order, s.group(eventbus.Event{}))
+	}
+
+	res := &Result{}
+	for _, c := range s.columns {
+		res.Columns = append(res.Columns, c.name)
+	}
+	for _, g := range order {
+		res.Rows = append(res.Rows, g.row())
+	}
+
+	if s.order >= 0 {
+		slices.SortStableFunc(res.Rows, func(a, b []any) int {
+			c := compare(a[s.order], b[s.order])
+			if s.desc {
+				return -c
+			}
+			return c
+		})
+	}
+	if s.limit >= 0 && len(res.Rows) > s.limit {
+		res.Rows = res.Rows[:s.limit]
+	}
+
+	return res, nil
+}
+
+// statement is a parsed statement.
+type statement struct {
+	columns []*column
+	query   eventbus.Query
+	by      []*eventbus.Expr
+	grouped bool
+	order   int
+	desc    bool
+	limit   int
+}
+
+// column is a selected column: an expression, or an aggregate over one.
+type column struct {
+	name string
+	expr *eventbus.Expr
+	agg  string
+}
+
+// key returns the group of e. Without GROUP BY or aggregates, every event
+// is a group of its own.
+func (s *statement) key(e eventbus.Event) (string, error) {
+	if !s.grouped {
+		return e.ID, nil
+	}
+
+	values := make([]any, len(s.by))
+	for i, x := range s.by {
+		values[i] = x.Eval(e)
+	}
+
+	data, err := json.Marshal(values)
+	return string(data), err
+}
+
+// group starts a group whose plain columns take their values from e.
+func (s *statement) group(e eventbus.Event) *group {
+	g := &group{columns: s.columns, acc: make([]accumulator, len(s.columns))}
+	for i, c := range s.columns {
+		if c.agg == "" && c.expr != nil {
+			g.acc[i].value = c.expr.Eval(e)
+		}
+	}
+	return g
+}
+
+type group struct {
+	columns []*column
+	acc     []accumulator
+}
+
+type accumulator struct {
+	value any
+	n     int
+	sum   float64
+}
+
+func (g *group) add(e eventbus.Event) {
+	for i, c := range g.columns {
+		a := &g.acc[i]
+		if c.agg == "" {
+			continue
+		}
+
+		var v any = true
+		if c.expr != nil {
+			v = c.expr.Eval(e)
+		}
+		if v == nil {
+			continue
+		}
+
+		switch c.agg {
+		case "count":
+			a.n++
+		case "sum", "avg":
+			if f, ok := v.(float64); ok {
+				a.n++
+				a.sum += f
+			}
+		case "min":
+			if a.value == nil || compare(v, a.value) < 0 {
+				a.value = v
+			}
+		case "max":
+			if a.value == nil || compare(v, a.value) > 0 {
+				a.value = v
+			}
+		}
+	}
+}
+
+func (g *group) row() []any {
+	row := make([]any, len(g.columns))
+	for i, c := range g.columns {
+		a := g.acc[i]
+		switch c.agg {
+		case "count":
+			row[i] = float64(a.n)
+		case "sum":
+			row[i] = a.sum
+		case "avg":
+			if a.n > 0 {
+				row[i] = a.sum / float64(a.n)
+			}
+		default:
+			row[i] = a.value
+		}
+	}
+	return row
+}
+
+// compare orders JSON values: nil first, then numbers, then strings, then
+// anything else, which compares equal.
+func compare(a, b any) int {
+	rank := func(v any) int {
+		switch v.(type) {
+		case nil:
+			return 0
+		case float64:
+			return 1
+		case string:
+			return 2
+		}
+		return 3
+	}
+
+	if c := cmp.Compare(rank(a), rank(b)); c != 0 {
+		return c
+	}
+
+	switch x := a.(type) {
+	case float64:
+		return cmp.Compare(x, b.(float64))
+	case string:
+		return strings.Compare(x, b.(string))
+	}
+	return 0
+}
+
+// parse parses a statement.
+func parse(stmt string) (*statement, error) {
+	clauses, err := split(stmt)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &statement{
+		query: eventbus.Query{Topic: eventbus.AllTopics},
+		order: -1,
+		limit: -1,
+	}
+
+	sel, ok := clauses["select"]
+	if !ok {
+		return nil, fmt.Errorf("%w: missing SELECT", ErrSyntax)
+	}
+	for _, item := range list(sel) {
+		cols, err := parseColumn(item)
+		if err != nil {
+			return nil, err
+		}
+		s.columns = append(s.columns, cols...)
+	}
+
+	if from, ok := clauses["from"]; ok {
+		if unquoted, err := strconv.Unquote(from); err == nil {
+			from = unquoted
+		}
+		if from == "" {
+			return nil, fmt.Errorf("%w: missing topic after FROM", ErrSyntax)
+		}
+		s.query.Topic = from
+	}
+
+	if where, ok := clauses["where"]; ok {
+		if s.query.Expr, err = eventbus.CompileExpr(where); err != nil {
+			return nil, err
+		}
+	}
+
+	var by []string
+	if groupBy, ok := clauses["group by"]; ok {
+		by = list(groupBy)
+		for _, term := range by {
+			x, err := eventbus.CompileExpr(term)
+			if err != nil {
+				return nil, err
+			}
+			s.by = append(s.by, x)
+		}
+		s.grouped = true
+	}
+	for _, c := range s.columns {
+		if c.agg != "" {
+			s.grouped = true
+		}
+	}
+	if s.grouped {
+		for _, c := range s.columns {
+			if c.agg == "" && !slices.Contains(by, c.name) {
+				return nil, fmt.Errorf("%w: column %s must be in GROUP BY or aggregated", ErrSyntax, c.name)
+			}
+		}
+	}
+
+	if orderBy, ok := clauses["order by"]; ok {
+		name := orderBy
+		if rest, ok := cutSuffixFold(orderBy, " desc"); ok {
+			name, s.desc = rest, true
+		} else if rest, ok := cutSuffixFold(orderBy, " asc"); ok {
+			name = rest
+		}
+		name = strings.TrimSpace(name)
+
+		s.order = slices.IndexFunc(s.columns, func(c *column) bool { return c.name == name })
+		if s.order < 0 {
+			return nil, fmt.Errorf("%w: ORDER BY %s is not a selected column", ErrSyntax, name)
+		}
+	}
+
+	if limit, ok := clauses["limit"]; ok {
+		if s.limit, err = strconv.Atoi(limit); err != nil || s.limit < 0 {
+			return nil, fmt.Errorf("%w: invalid LIMIT %s", ErrSyntax, limit)
+		}
+	}
+
+	return s, nil
+}
+
+// parseColumn parses a selected item into its columns.
+func parseColumn(item string) ([]*column, error) {
+	if item == "*" {
+		var cols []*column
+		for _, name := range []string{"id", "topic", "type", "version", "payload"} {
+			x, _ := eventbus.CompileExpr(name)
+			cols = append(cols, &column{name: name, expr: x})
+		}
+		return cols, nil
+	}
+
+	if open := strings.IndexByte(item, '('); open > 0 && strings.HasSuffix(item, ")") {
+		agg := strings.ToLower(strings.TrimSpace(item[:open]))
+		switch agg {
+		case "count", "sum", "avg", "min", "max":
+			arg := strings.TrimSpace(item[open+1 : len(item)-1])
+			c := &column{name: item, agg: agg}
+			if arg == "*" && agg == "count" {
+				return []*column{c}, nil
+			}
+
+			var err error
+			if c.expr, err = eventbus.CompileExpr(arg); err != nil {
+				return nil, err
+			}
+			return []*column{c}, nil
+		}
+	}
+
+	x, err := eventbus.CompileExpr(item)
+	if err != nil {
+		return nil, err
+	}
+	return []*column{{name: item, expr: x}}, nil
+}
+
+// keywords are the clause keywords, in the order they must appear.
+var keywords = []string{"select", "from", "where", "group by", "order by", "limit"}
+
+// split cuts stmt into its clauses, keyed by lowercase keyword. Keywords
+// inside double-quoted strings are ignored.
+func split(stmt string) (map[string]string, error) {
+	clauses := make(map[string]string)
+	current, start, last := "", 0, -1
+
+	quoted := false
+	for i := 0; i < len(stmt); i++ {
+		switch c := stmt[i]; {
+		case quoted && c == '\\':
+			i++
+			continue
+		case c == '"':
+			quoted = !quoted
+			continue
+		case quoted:
+			continue
+		}
+
+		if i > 0 && !isSpace(stmt[i-1]) && stmt[i-1] != ')' {
+			continue
+		}
+		for k, kw := range keywords {
+			n := keyword(stmt[i:], kw)
+			if n == 0 {
+				continue
+			}
+			if k <= last {
+				return nil, fmt.Errorf("%w: unexpected %s", ErrSyntax, strings.ToUpper(kw))
+			}
+
+			if current != "" {
+				clauses[current] = strings.TrimSpace(stmt[start:i])
+			} else if k != 0 || strings.TrimSpace(stmt[:i]) != "" {
+				return nil, fmt.Errorf("%w: statement must start with SELECT", ErrSyntax)
+			}
+			current, start, last = kw, i+n, k
+			i += n - 1
+			break
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("%w: unterminated string", ErrSyntax)
+	}
+	if current != "" {
+		clauses[current] = strings.TrimSpace(stmt[start:])
+	}
+
+	return clauses, nil
+}
+
+// keyword returns the length of the keyword kw at the start of s, followed
+// by a space or the end of s, or 0 if s does not start with it. Spaces inside
+// kw match any run of spaces.
+func keyword(s, kw string) int {
+	n := 0
+	for i, word := range strings.Fields(kw) {
+		if i > 0 {
+			spaces := len(s) - len(strings.TrimLeft(s, " \t\n\r"))
+			if spaces == 0 {
+				return 0
+			}
+			s, n = s[spaces:], n+spaces
+		}
+		if len(s) < len(word) || !strings.EqualFold(s[:len(word)], word) {
+			return 0
+		}
+		s, n = s[len(word):], n+len(word)
+	}
+	if s != "" && !isSpace(s[0]) {
+		return 0
+	}
+	return n
+}
+
+// list splits a comma-separated list, ignoring commas inside parentheses and
+// strings.
+func list(s string) []string {
+	var items []string
+	depth, quoted, start := 0, false, 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quoted && c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			items = append(items, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(items, strings.TrimSpace(s[start:]))
+}
+
+func cutSuffixFold(s, suffix string) (string, bool) {
+	if len(s) >= len(suffix) && strings.EqualFold(s[len(s)-len(suffix):], suffix) {
+		return s[:len(s)-len(suffix)], true
+	}
+	return s, false
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
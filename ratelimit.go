@@ -0,0 +1,59 @@
+package eventbus
+
+import "time"
+
+// WithRateLimit throttles delivery to the subscription to n events per
+// period, with bursts of up to n events. Stored events over the limit are
+// not dropped: they wait in the log and are sent, in order, as the rate
+// allows, like history during replay. Events published with PublishUnstored
+// over the limit are dropped.
+//
+// It suits consumers with hard rate caps, such as webhooks or email
+// providers. Members of consumer groups are not throttled.
+func WithRateLimit(n int, per time.Duration) SubscribeOption {
+	return func(s *subscriber) {
+		if n > 0 && per > 0 {
+			s.limit = &limiter{n: n, per: per, tokens: float64(n)}
+		}
+	}
+}
+
+// limiter is a token bucket. It is only used with the bus lock held.
+type limiter struct {
+	n      int
+	per    time.Duration
+	tokens float64
+	last   time.Time
+}
+
+func (l *limiter) refill(now time.Time) {
+	if !l.last.IsZero() {
+		elapsed := now.Sub(l.last)
+		l.tokens = min(float64(l.n), l.tokens+float64(l.n)*float64(elapsed)/float64(l.per))
+	}
+	l.last = now
+}
+
+// allow takes a token and reports whether there was one.
+func (l *limiter) allow(now time.Time) bool {
+	l.refill(now)
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// refund gives back a token taken for an event that could not be sent.
+func (l *limiter) refund() {
+	l.tokens++
+}
+
+// delay returns how long to wait before a token is available.
+func (l *limiter) delay(now time.Time) time.Duration {
+	l.refill(now)
+	if l.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - l.tokens) * float64(l.per) / float64(l.n))
+}
@@ -0,0 +1,152 @@
+package eventbus
+
+import "time"
+
+// catchUp sends sub the events matching its query from position start, as
+// long as they fit in its buffer and its rate limit allows. If the buffer
+// fills up or the limit is reached first, it marks the subscriber as pumping
+// and returns the event that could not be sent and true: b.pump must then be
+// started to send the rest, while live delivery skips the subscriber. It must
+// be called with b.mu held.
+func (b *Bus) catchUp(sub *subscriber, start int) (Event, bool) {
+	now := time.Now()
+	for i := range b.positions(sub.query, start, len(b.events), false) {
+		e := b.events[i]
+		if e.expired(now) || !sub.match(e) {
+			continue
+		}
+
+		if sub.limit != nil && !sub.limit.allow(now) {
+			sub.pumping = true
+			return e, true
+		}
+
+		select {
+		case sub.ch <- e:
+			sub.sent(e)
+		default:
+			if sub.limit != nil {
+				sub.limit.refund()
+			}
+			sub.pumping = true
+			return e, true
+		}
+	}
+
+	return Event{}, false
+}
+
+// pump sends sub the stored events it has not been sent yet, waiting for
+// room in its buffer and for its rate limit, until it has caught up with the
+// log. The switch to live delivery happens under the bus lock, so no event is
+// missed or sent twice.
+//
+// While pumping, the channel belongs to the pump: closing the subscription
+// only signals quit, and the pump closes the channel on its way out.
+func (b *Bus) pump(sub *subscriber) {
+	for {
+		b.mu.Lock()
+		if _, ok := b.subscribers[sub]; !ok {
+			b.stop(sub)
+			b.mu.Unlock()
+			return
+		}
+
+		start, ok, trimmed := b.start(sub.lastID)
+		if sub.paused || !ok {
+			// Resume catches up again from lastID
+			sub.pumping = false
+			sub.wake()
+			b.mu.Unlock()
+			return
+		}
+
+		sub.trimmed(trimmed)
+		e, full := b.catchUp(sub, start)
+		if !full {
+			sub.pumping = false
+			sub.wake()
+			b.mu.Unlock()
+			return
+		}
+
+		if sub.limit != nil {
+			if d := sub.limit.delay(time.Now()); d > 0 {
+				b.mu.Unlock()
+				if !sub.sleep(d) {
+					b.mu.Lock()
+					b.stop(sub)
+					b.mu.Unlock()
+					return
+				}
+				continue
+			}
+		}
+		// the position moves before the send, so that a TopicSet can rewind
+		// it meanwhile
+		prev := sub.lastID
+		sub.advance(e)
+		b.mu.Unlock()
+
+		select {
+		case sub.ch <- e:
+		case <-sub.quit:
+			b.mu.Lock()
+			sub.lastID = prev // e was not sent
+			b.stop(sub)
+			b.mu.Unlock()
+			return
+		}
+
+		b.mu.Lock()
+		sub.entered(e)
+		if _, ok := b.subscribers[sub]; ok {
+			sub.acked(e)
+			if sub.limit != nil {
+				sub.limit.allow(time.Now())
+			}
+		}
+		b.mu.Unlock()
+	}
+}
+
+// stop closes the channel of sub, a subscriber closed while pumping, and
+// hands the history it had yet to replay over to its group. It must be
+// called with b.mu held.
+func (b *Bus) stop(sub *subscriber) {
+	close(sub.ch)
+	if sub.group != "" {
+		b.handOver(sub)
+	}
+}
+
+// sleep waits for d and reports false if the subscriber is closed before.
+func (s *subscriber) sleep(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-s.quit:
+		return false
+	}
+}
+
+// unsubscribe unregisters sub and reports whether the caller must close its
+// channel, which is not the case while a pump owns it. It must be called
+// with b.mu held.
+func (b *Bus) unsubscribe(sub *subscriber) bool {
+	delete(b.subscribers, sub)
+	sub.closing(nil)
+	if sub.group != "" {
+		b.leave(sub)
+	}
+
+	if sub.pumping {
+		close(sub.quit)
+		return false
+	}
+
+	return true
+}
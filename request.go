@@ -0,0 +1,114 @@
+package eventbus
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// replyTTL is how long replies, and requests without a deadline, stay in the
+// log.
+const replyTTL = time.Minute
+
+// Request is the payload of the request events published by Bus.Request.
+type Request struct {
+	// CorrelationID identifies the request, and its reply.
+	CorrelationID string `json:"correlation_id"`
+
+	// ReplyTo is the topic to publish the reply on.
+	ReplyTo string `json:"reply_to"`
+
+	Payload any `json:"payload"`
+}
+
+// Reply is the payload of the reply events published by Bus.Reply.
+type Reply struct {
+	CorrelationID string `json:"correlation_id"`
+	Payload       any    `json:"payload"`
+}
+
+// Request publishes an event of type eventType on topic with a Request
+// payload wrapping payload, then waits for the Reply with the same
+// correlation ID on the topic ReplyTo, topic followed by ".reply", and
+// returns it. It returns the context's error if ctx is done first, and
+// ErrClosed if the bus is closed meanwhile.
+//
+// Responders subscribe to topic, and answer each request with Reply. Replies
+// are matched on their correlation ID field, so that responders on another
+// bus, whose events went through JSON, can answer too.
+//
+// Requests and replies are appended to the log like other events, but
+// expire, at the deadline of ctx for requests, or a minute after they are
+// published, so that Sweep removes them.
+func (b *Bus) Request(ctx context.Context, topic, eventType string, payload any) (Event, error) {
+	if topic == "" {
+		return Event{}, ErrNoTopic
+	}
+
+	req := Request{
+		CorrelationID: correlationID(),
+		ReplyTo:       topic + ".reply",
+		Payload:       payload,
+	}
+
+	// subscribe first, so that the reply cannot come before
+	q := Query{Topic: req.ReplyTo, AfterID: b.End()}
+	sub, err := b.subscribe(q.Where("correlation_id", req.CorrelationID), 1, nil)
+	if err != nil {
+		return Event{}, err
+	}
+	defer sub.Close()
+
+	e := Event{Topic: topic, Type: eventType, Payload: req, Timestamp: time.Now().UTC()}
+	e.ExpiresAt = e.Timestamp.Add(replyTTL)
+	if deadline, ok := ctx.Deadline(); ok {
+		e.ExpiresAt = deadline.UTC()
+	}
+	if _, err := b.publishUnchecked(e); err != nil {
+		return Event{}, err
+	}
+
+	select {
+	case e, ok := <-sub.C:
+		if !ok {
+			return Event{}, ErrClosed
+		}
+		return e, nil
+	case <-ctx.Done():
+		return Event{}, ctx.Err()
+	}
+}
+
+// Reply answers a request event published by Request with an event of type
+// eventType on its reply topic, with a Reply payload wrapping payload. The
+// request can be a Request or its JSON decoding, as read from a store or
+// another bus. If req is not a request, Reply returns ErrInvalidPayload.
+//
+// The reply expires a minute after it is published.
+func (b *Bus) Reply(req Event, eventType string, payload any) error {
+	v, _ := field(req.Payload, "correlation_id")
+	id, _ := v.(string)
+	v, _ = field(req.Payload, "reply_to")
+	replyTo, _ := v.(string)
+	if id == "" || replyTo == "" {
+		return ErrInvalidPayload
+	}
+
+	now := time.Now().UTC()
+	_, err := b.publishUnchecked(Event{
+		Topic:     replyTo,
+		Type:      eventType,
+		Payload:   Reply{CorrelationID: id, Payload: payload},
+		Timestamp: now,
+		ExpiresAt: now.Add(replyTTL),
+	})
+	return err
+}
+
+// correlationID returns a random identifier.
+func correlationID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,260 @@
+package eventbus
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Retention limits how many events of a topic are kept in the log.
+//
+// Zero values disable their corresponding limit. When several limits are set,
+// an event is removed as soon as any of them is exceeded. Limits always apply
+// per topic, and the newest events of a topic are the ones that are kept.
+type Retention struct {
+	// MaxAge removes events whose timestamp is older than this duration.
+	MaxAge time.Duration
+
+	// MaxEvents keeps at most this many events for the topic.
+	MaxEvents int
+
+	// MaxBytes keeps at most this many bytes of events for the topic, as
+	// measured by the size of their JSON encoding.
+	MaxBytes int
+
+	// WarnAt is the fraction of MaxEvents or MaxBytes, such as 0.8, from which
+	// Sweep publishes a QuotaWarning on MetaTopic, so that operators can react
+	// before events start being evicted. A zero value disables warnings.
+	// Warnings go through validators and precommit hooks like other events.
+	// One that is vetoed or that the store refuses is traced as TraceVetoed
+	// or TraceFailed, and published again on the next Sweep.
+	WarnAt float64
+}
+
+// MetaTopic is the topic on which the bus publishes events about itself.
+const MetaTopic = "eventbus.meta"
+
+// QuotaWarningType is the event type of QuotaWarning events.
+const QuotaWarningType = "quota_warning"
+
+// QuotaWarning is the payload of the events published on MetaTopic when a
+// topic reaches the WarnAt fraction of one of its retention limits. It is
+// published once when the threshold is crossed, and again only after usage
+// went back below it.
+type QuotaWarning struct {
+	Topic string `json:"topic"`
+
+	// Limit is "events" for MaxEvents or "bytes" for MaxBytes.
+	Limit string `json:"limit"`
+	Used  int    `json:"used"`
+	Max   int    `json:"max"`
+}
+
+// SetRetention configures the retention policy for a topic.
+//
+// A policy set for AllTopics applies to every topic that has no policy of
+// its own. Passing a zero Retention removes the policy for that topic.
+//
+// Retention, like event expiry, is only enforced when Sweep runs, either
+// explicitly or from the background sweeper started with StartSweeper.
+func (b *Bus) SetRetention(topic string, r Retention) error {
+	if topic == "" {
+		return ErrNoTopic
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if r == (Retention{}) {
+		delete(b.retention, topic)
+		return nil
+	}
+
+	b.retention[topic] = r
+	return nil
+}
+
+// Sweep removes the events that exceed their topic's retention policy, as
+// well as expired events, and returns how many events were removed.
+//
+// Subscribers that later use a removed ID as fromID are not rejected: their
+// replay starts at the next retained event and their Subscription is marked
+// as Trimmed.
+func (b *Bus) Sweep() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.sweep(time.Now().UTC())
+}
+
+func (b *Bus) sweep(now time.Time) int {
+	if b.frozen {
+		return 0
+	}
+
+	type usage struct {
+		policy Retention
+		events int
+		bytes  int
+
+		// kept only counts the events that stay in the log
+		keptEvents int
+		keptBytes  int
+	}
+
+	used := make(map[string]*usage)
+	remove := make([]bool, len(b.events))
+	removed := 0
+
+	// walk backwards so that the newest events of each topic are kept
+	for i := len(b.events) - 1; i >= 0; i-- {
+		e := b.events[i]
+
+		if e.expired(now) {
+			remove[i] = true
+			removed++
+			continue
+		}
+
+		r, ok := b.retention[e.Topic]
+		if !ok {
+			if r, ok = b.retention[AllTopics]; !ok {
+				continue
+			}
+		}
+
+		u := used[e.Topic]
+		if u == nil {
+			u = &usage{policy: r}
+			used[e.Topic] = u
+		}
+
+		size := 0
+		if r.MaxBytes > 0 {
+			size = eventSize(e)
+		}
+		u.events++
+		u.bytes += size
+
+		switch {
+		case r.MaxAge > 0 && now.Sub(e.Timestamp) > r.MaxAge,
+			r.MaxEvents > 0 && u.events > r.MaxEvents,
+			r.MaxBytes > 0 && u.bytes > r.MaxBytes:
+			remove[i] = true
+			removed++
+		default:
+			u.keptEvents++
+			u.keptBytes += size
+		}
+	}
+
+	if removed > 0 {
+		kept := make([]Event, 0, len(b.events)-removed)
+		for i, e := range b.events {
+			if !remove[i] {
+				kept = append(kept, e)
+				continue
+			}
+
+			if v, err := strconv.ParseUint(e.ID, 10, 64); err == nil && v > b.trimmedSeq {
+				b.trimmedSeq = v
+			}
+		}
+
+		b.events = kept
+		b.reindex()
+	}
+
+	for _, topic := range slices.Sorted(maps.Keys(used)) {
+		u := used[topic]
+		if topic == MetaTopic || u.policy.WarnAt <= 0 {
+			continue
+		}
+		b.warnQuota(topic, "events", u.keptEvents, u.policy.MaxEvents, u.policy.WarnAt)
+		b.warnQuota(topic, "bytes", u.keptBytes, u.policy.MaxBytes, u.policy.WarnAt)
+	}
+
+	return removed
+}
+
+// warnQuota publishes a QuotaWarning when used crosses the warnAt fraction of
+// max. It must be called with b.mu held.
+func (b *Bus) warnQuota(topic, limit string, used, max int, warnAt float64) {
+	if max <= 0 {
+		return
+	}
+
+	key := topic + "\x00" + limit
+	if float64(used) < warnAt*float64(max) {
+		delete(b.warned, key)
+		return
+	}
+	if b.warned[key] {
+		return
+	}
+
+	e := Event{
+		Topic: MetaTopic,
+		Type:  QuotaWarningType,
+		Payload: QuotaWarning{
+			Topic: topic,
+			Limit: limit,
+			Used:  used,
+			Max:   max,
+		},
+		Timestamp: time.Now().UTC(),
+	}
+	// there is no one to report an error to: warn again on the next sweep
+	if b.admit(e) != nil {
+		b.traceTopic(TraceVetoed, e, nil)
+		return
+	}
+	if _, err := b.append(e, true); err != nil {
+		b.traceTopic(TraceFailed, e, nil)
+		return
+	}
+	b.warned[key] = true
+}
+
+// eventSize approximates the memory used by an event with the size of its
+// JSON encoding.
+func eventSize(e Event) int {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
+
+// StartSweeper runs Sweep in the background every interval until Close is
+// called. Calling StartSweeper again replaces the previous sweeper.
+func (b *Bus) StartSweeper(interval time.Duration) {
+	stop := make(chan struct{})
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	if b.sweeper != nil {
+		close(b.sweeper)
+	}
+	b.sweeper = stop
+	b.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				b.Sweep()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,206 @@
+package eventbus
+
+import (
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Router owns a set of buses, one per namespace, such as a tenant or a
+// bounded context, and routes publishes and subscriptions to them by topic.
+//
+// Topic ownership is sticky: the first time a topic is routed, the router
+// remembers which namespace owns it, and keeps using that bus for the topic
+// even if the routing function would later answer differently.
+type Router struct {
+	route func(topic string) string
+
+	mu     sync.Mutex
+	buses  map[string]*Bus
+	owners map[string]string
+}
+
+// NewRouter creates a Router that uses route to find the namespace owning a
+// topic. route must return a non-empty namespace.
+func NewRouter(route func(topic string) string) *Router {
+	return &Router{
+		route:  route,
+		buses:  make(map[string]*Bus),
+		owners: make(map[string]string),
+	}
+}
+
+// PrefixRoute returns a routing function that uses the part of the topic
+// before sep as namespace, such as "tenant-a" for "tenant-a/orders". Topics
+// without sep are routed to fallback.
+func PrefixRoute(sep, fallback string) func(topic string) string {
+	return func(topic string) string {
+		ns, _, ok := strings.Cut(topic, sep)
+		if !ok {
+			return fallback
+		}
+		return ns
+	}
+}
+
+// Bus returns the bus of a namespace, creating it if needed.
+func (r *Router) Bus(namespace string) (*Bus, error) {
+	if namespace == "" {
+		return nil, ErrNoNamespace
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.bus(namespace), nil
+}
+
+func (r *Router) bus(namespace string) *Bus {
+	b, ok := r.buses[namespace]
+	if !ok {
+		b = New()
+		r.buses[namespace] = b
+	}
+	return b
+}
+
+// Assign makes namespace the owner of topic, overriding the routing function.
+// Events already published on the topic in another namespace are not moved.
+func (r *Router) Assign(topic, namespace string) error {
+	if topic == "" {
+		return ErrNoTopic
+	}
+	if namespace == "" {
+		return ErrNoNamespace
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.owners[topic] = namespace
+	return nil
+}
+
+// BusFor returns the bus owning topic, routing the topic first if it has no
+// owner yet.
+func (r *Router) BusFor(topic string) (*Bus, error) {
+	if topic == "" || topic == AllTopics {
+		return nil, ErrNoTopic
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ns, ok := r.owners[topic]
+	if !ok {
+		ns = r.route(topic)
+		if ns == "" {
+			return nil, ErrNoNamespace
+		}
+		r.owners[topic] = ns
+	}
+
+	return r.bus(ns), nil
+}
+
+// Publish publishes on the bus owning topic. See Bus.Publish.
+func (r *Router) Publish(topic, eventType string, payload any, lastID string) (string, error) {
+	b, err := r.BusFor(topic)
+	if err != nil {
+		return "", err
+	}
+	return b.Publish(topic, eventType, payload, lastID)
+}
+
+// Subscribe subscribes on the bus owning topic. See Bus.Subscribe.
+//
+// A topic belongs to a single namespace, so AllTopics cannot be routed and
+// returns ErrNoTopic; subscribe to AllTopics on the bus returned by Bus
+// instead.
+func (r *Router) Subscribe(topic, fromID string) (*Subscription, error) {
+	b, err := r.BusFor(topic)
+	if err != nil {
+		return nil, err
+	}
+	return b.Subscribe(topic, fromID)
+}
+
+// Namespaces returns the namespaces that have a bus, sorted.
+func (r *Router) Namespaces() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	namespaces := make([]string, 0, len(r.buses))
+	for ns := range r.buses {
+		namespaces = append(namespaces, ns)
+	}
+	slices.Sort(namespaces)
+
+	return namespaces
+}
+
+// SaveDir saves every bus to its own JSON file in dir, named after its
+// namespace.
+func (r *Router) SaveDir(dir string) error {
+	r.mu.Lock()
+	buses := make(map[string]*Bus, len(r.buses))
+	for ns, b := range r.buses {
+		buses[ns] = b
+	}
+	r.mu.Unlock()
+
+	for ns, b := range buses {
+		if err := b.SaveToFile(filepath.Join(dir, url.PathEscape(ns)+".json")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LoadDir loads the buses saved in dir by SaveDir, replacing the buses of the
+// same namespaces. The topics found in each bus are assigned to its namespace.
+func (r *Router) LoadDir(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		ns, err := url.PathUnescape(strings.TrimSuffix(filepath.Base(path), ".json"))
+		if err != nil || ns == "" {
+			continue
+		}
+
+		b, err := NewFromFile(path)
+		if err != nil {
+			return err
+		}
+
+		r.mu.Lock()
+		if old, ok := r.buses[ns]; ok {
+			old.Close()
+		}
+		r.buses[ns] = b
+		b.ForEachEvent(Query{}, func(e Event) {
+			r.owners[e.Topic] = ns
+		})
+		r.mu.Unlock()
+	}
+
+	return nil
+}
+
+// Close closes every bus of the router.
+func (r *Router) Close() {
+	r.mu.Lock()
+	buses := r.buses
+	r.buses = make(map[string]*Bus)
+	r.mu.Unlock()
+
+	for _, b := range buses {
+		b.Close()
+	}
+}
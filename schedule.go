@@ -0,0 +1,275 @@
+package eventbus
+
+import (
+	"container/heap"
+	"strconv"
+	"time"
+)
+
+// scheduled is an event waiting to be published by the scheduler.
+type scheduled struct {
+	Key     string    `json:"key"`
+	Due     time.Time `json:"due"`
+	Topic   string    `json:"topic"`
+	Type    string    `json:"type"`
+	Payload any       `json:"payload"`
+
+	// CancelOn is an event type that cancels this event when it is appended
+	// to the same topic before the due time.
+	CancelOn string `json:"cancel_on,omitempty"`
+}
+
+// schedule is a min-heap of scheduled events ordered by due time. Events due
+// at the same time keep the order in which they were scheduled.
+type schedule struct {
+	items []*scheduled
+	seq   uint64
+}
+
+func (s *schedule) Len() int { return len(s.items) }
+
+func (s *schedule) Less(i, j int) bool {
+	if s.items[i].Due.Equal(s.items[j].Due) {
+		return keySeq(s.items[i].Key) < keySeq(s.items[j].Key)
+	}
+	return s.items[i].Due.Before(s.items[j].Due)
+}
+
+func (s *schedule) Swap(i, j int) { s.items[i], s.items[j] = s.items[j], s.items[i] }
+
+func (s *schedule) Push(x any) { s.items = append(s.items, x.(*scheduled)) }
+
+func (s *schedule) Pop() any {
+	n := len(s.items)
+	item := s.items[n-1]
+	s.items[n-1] = nil
+	s.items = s.items[:n-1]
+	return item
+}
+
+func (s *schedule) add(item scheduled) string {
+	s.seq++
+	item.Key = "s" + strconv.FormatUint(s.seq, 10)
+
+	heap.Push(s, &item)
+
+	return item.Key
+}
+
+// cancelOn removes the events that e cancels.
+func (s *schedule) cancelOn(e Event) {
+	var keys []string
+	for _, item := range s.items {
+		if item.CancelOn != "" && item.CancelOn == e.Type && item.Topic == e.Topic {
+			keys = append(keys, item.Key)
+		}
+	}
+
+	for _, key := range keys {
+		s.remove(key)
+	}
+}
+
+func (s *schedule) remove(key string) bool {
+	for i, item := range s.items {
+		if item.Key == key {
+			heap.Remove(s, i)
+			return true
+		}
+	}
+	return false
+}
+
+// due pops the events whose due time is not after now, in due order.
+func (s *schedule) due(now time.Time) []*scheduled {
+	var items []*scheduled
+	for len(s.items) > 0 && !s.items[0].Due.After(now) {
+		items = append(items, heap.Pop(s).(*scheduled))
+	}
+	return items
+}
+
+// list returns a copy of the pending events in due order.
+func (s *schedule) list() []scheduled {
+	if len(s.items) == 0 {
+		return nil
+	}
+
+	sorted := &schedule{items: append([]*scheduled(nil), s.items...)}
+	items := make([]scheduled, 0, len(s.items))
+	for sorted.Len() > 0 {
+		items = append(items, *heap.Pop(sorted).(*scheduled))
+	}
+	return items
+}
+
+func (s *schedule) reset(items []scheduled) {
+	s.items = make([]*scheduled, 0, len(items))
+	s.seq = 0
+	for _, item := range items {
+		s.items = append(s.items, &item)
+		s.seq = max(s.seq, keySeq(item.Key))
+	}
+	heap.Init(s)
+}
+
+func keySeq(key string) uint64 {
+	v, _ := strconv.ParseUint(key[min(1, len(key)):], 10, 64)
+	return v
+}
+
+// PublishAt schedules an event to be appended to the log and delivered to
+// subscribers at t. Until then, the event is invisible to queries and
+// subscriptions. If t is in the past, the event is published right away.
+//
+// Scheduled events are appended after the current end of the bus when they
+// become due, without any concurrency check, and are timestamped with the time
+// they were actually published. Pending events are included in Dump and
+// restored by Load. If the store of the bus refuses the event when it is due,
+// it stays pending, ahead of the events due after it, and is tried again a
+// second later.
+//
+// PublishAt returns a key that can be passed to CancelScheduled.
+// If topic is empty, PublishAt returns ErrNoTopic.
+func (b *Bus) PublishAt(t time.Time, topic, eventType string, payload any) (string, error) {
+	if topic == "" {
+		return "", ErrNoTopic
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return "", ErrClosed
+	}
+
+	if err := b.enforce(Event{Topic: topic, Type: eventType, Payload: payload}); err != nil {
+		return "", err
+	}
+
+	key := b.schedule.add(scheduled{
+		Due:     t.UTC(),
+		Topic:   topic,
+		Type:    eventType,
+		Payload: payload,
+	})
+	b.armSchedule()
+
+	return key, nil
+}
+
+// PublishAfter is like PublishAt but schedules the event to be published once
+// d has elapsed.
+func (b *Bus) PublishAfter(d time.Duration, topic, eventType string, payload any) (string, error) {
+	return b.PublishAt(time.Now().Add(d), topic, eventType, payload)
+}
+
+// PublishTimeout schedules a timeout event of type timeoutType on topic,
+// published once d has elapsed unless an event of type cancelType is appended
+// to the same topic first.
+//
+// It turns "no payment within 15 minutes" into an event that sagas can react
+// to, such as PublishTimeout(15*time.Minute, "order-42", "PaymentReceived",
+// "PaymentTimedOut", nil). The pending timeout is persisted with the other
+// scheduled events, and can be disarmed with CancelScheduled using the
+// returned key.
+func (b *Bus) PublishTimeout(d time.Duration, topic, cancelType, timeoutType string, payload any) (string, error) {
+	if topic == "" {
+		return "", ErrNoTopic
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return "", ErrClosed
+	}
+
+	if err := b.enforce(Event{Topic: topic, Type: timeoutType, Payload: payload}); err != nil {
+		return "", err
+	}
+
+	key := b.schedule.add(scheduled{
+		Due:      time.Now().Add(d).UTC(),
+		Topic:    topic,
+		Type:     timeoutType,
+		Payload:  payload,
+		CancelOn: cancelType,
+	})
+	b.armSchedule()
+
+	return key, nil
+}
+
+// CancelScheduled removes a pending event scheduled with PublishAt or
+// PublishAfter. It reports whether the event was still pending.
+func (b *Bus) CancelScheduled(key string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ok := b.schedule.remove(key)
+	b.armSchedule()
+
+	return ok
+}
+
+// armSchedule sets the timer to fire when the next scheduled event is due.
+// It must be called with b.mu held.
+func (b *Bus) armSchedule() {
+	if b.writable() != nil || b.schedule.Len() == 0 {
+		if b.timer != nil {
+			b.timer.Stop()
+		}
+		return
+	}
+
+	wait := max(time.Until(b.schedule.items[0].Due), time.Until(b.holdUntil))
+	if b.timer == nil {
+		b.timer = time.AfterFunc(wait, b.publishDue)
+		return
+	}
+	b.timer.Reset(wait)
+}
+
+// scheduleRetry is the time after which a scheduled event that the store
+// refused is tried again.
+const scheduleRetry = time.Second
+
+// publishDue appends the scheduled events that are due and rearms the timer.
+// A vetoed event is dropped and traced as TraceVetoed for its topic. An
+// event the store refuses is traced as TraceFailed and stays scheduled, along
+// with those due after it, and the scheduler tries again after
+// scheduleRetry, so that due order holds.
+func (b *Bus) publishDue() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.writable() != nil {
+		return
+	}
+
+	due := b.schedule.due(time.Now())
+	for i, item := range due {
+		e := Event{
+			Topic:     item.Topic,
+			Type:      item.Type,
+			Payload:   item.Payload,
+			Timestamp: time.Now().UTC(),
+		}
+		if b.admit(e) != nil {
+			// there is no one to report the error to
+			b.traceTopic(TraceVetoed, e, nil)
+			continue
+		}
+		if _, err := b.append(e, true); err != nil {
+			b.traceTopic(TraceFailed, e, nil)
+			for _, item := range due[i:] {
+				heap.Push(&b.schedule, item)
+			}
+			b.holdUntil = time.Now().Add(scheduleRetry)
+			break
+		}
+	}
+
+	b.armSchedule()
+}
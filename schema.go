@@ -0,0 +1,178 @@
+package eventbus
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// SchemaMode tells when the schema of a topic is enforced.
+type SchemaMode int
+
+const (
+	// SchemaOnRead leaves payloads unchecked at publish time: consumers
+	// interpret them, and can check them with Bus.Validate. It is the mode of
+	// topics without a schema.
+	SchemaOnRead SchemaMode = iota
+
+	// SchemaOnWrite rejects events that do not match the schema of their
+	// topic when they are published, with ErrInvalidPayload.
+	SchemaOnWrite
+)
+
+func (m SchemaMode) String() string {
+	switch m {
+	case SchemaOnRead:
+		return "on-read"
+	case SchemaOnWrite:
+		return "on-write"
+	default:
+		return fmt.Sprintf("SchemaMode(%d)", int(m))
+	}
+}
+
+// Schema describes the events of a topic.
+type Schema struct {
+	Mode SchemaMode
+
+	// Types maps each event type of the topic to a value of the Go type of
+	// its payload, as in LoadFixture. A payload matches if it has that type,
+	// or if its JSON encoding decodes into that type without unknown fields,
+	// which is what payloads loaded from a dump look like. If Types is not
+	// empty, events of other types do not match. An entry with a nil value
+	// accepts any payload.
+	Types map[string]any
+
+	// Validate, if not nil, further checks the events whose payload matches
+	// Types. When enforcing SchemaOnWrite, it is called while the bus lock is
+	// held, so it must not call back into the bus.
+	Validate func(Event) error
+}
+
+// check returns an error wrapping ErrInvalidPayload if e does not match s.
+func (s Schema) check(e Event) error {
+	if len(s.Types) > 0 {
+		proto, ok := s.Types[e.Type]
+		if !ok {
+			return fmt.Errorf("%w: topic %q has no event type %q", ErrInvalidPayload, e.Topic, e.Type)
+		}
+		if err := conform(e.Payload, proto); err != nil {
+			return fmt.Errorf("%w: %s on %q: %v", ErrInvalidPayload, e.Type, e.Topic, err)
+		}
+	}
+
+	if s.Validate != nil {
+		if err := s.Validate(e); err != nil {
+			return fmt.Errorf("%w: %s on %q: %v", ErrInvalidPayload, e.Type, e.Topic, err)
+		}
+	}
+
+	return nil
+}
+
+// conform returns an error unless payload has the type of proto, or decodes
+// into it.
+func conform(payload, proto any) error {
+	if proto == nil {
+		return nil
+	}
+
+	want := reflect.TypeOf(proto)
+	if reflect.TypeOf(payload) == want {
+		return nil
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(reflect.New(want).Interface()); err != nil {
+		return fmt.Errorf("payload is not a %v: %v", want, err)
+	}
+
+	return nil
+}
+
+// SetSchema configures the schema of a topic.
+//
+// A schema set for AllTopics applies to every topic that has no schema of
+// its own. Passing a zero Schema removes the schema for that topic. Changing
+// the mode of a topic from SchemaOnRead to SchemaOnWrite makes it strict from
+// then on, without checking the events already in the log, so topics can be
+// migrated one at a time.
+func (b *Bus) SetSchema(topic string, s Schema) error {
+	if topic == "" {
+		return ErrNoTopic
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if s.Mode == SchemaOnRead && len(s.Types) == 0 && s.Validate == nil {
+		delete(b.schemas, topic)
+		return nil
+	}
+
+	b.schemas[topic] = s
+	return nil
+}
+
+// Schema returns the schema that applies to a topic, either its own or the
+// one set for AllTopics, and whether there is one.
+func (b *Bus) Schema(topic string) (Schema, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.schema(topic)
+}
+
+// SchemaModes returns the mode of every topic that has a schema of its own,
+// or AllTopics for the default one.
+func (b *Bus) SchemaModes() map[string]SchemaMode {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	modes := make(map[string]SchemaMode, len(b.schemas))
+	for topic, s := range b.schemas {
+		modes[topic] = s.Mode
+	}
+
+	return modes
+}
+
+// Validate checks e against the schema of its topic, whatever its mode. It
+// returns an error wrapping ErrInvalidPayload if e does not match, and nil if
+// the topic has no schema.
+func (b *Bus) Validate(e Event) error {
+	s, ok := b.Schema(e.Topic)
+	if !ok {
+		return nil
+	}
+
+	return s.check(e)
+}
+
+// schema returns the schema that applies to topic. It must be called with
+// b.mu held.
+func (b *Bus) schema(topic string) (Schema, bool) {
+	if s, ok := b.schemas[topic]; ok {
+		return s, true
+	}
+
+	s, ok := b.schemas[AllTopics]
+	return s, ok
+}
+
+// enforce checks e against the schema of its topic if the topic is in
+// SchemaOnWrite mode. It must be called with b.mu held.
+func (b *Bus) enforce(e Event) error {
+	if s, ok := b.schema(e.Topic); ok && s.Mode == SchemaOnWrite {
+		return s.check(e)
+	}
+
+	return nil
+}
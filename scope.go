@@ -0,0 +1,162 @@
+package eventbus
+
+import (
+	"strings"
+	"sync"
+)
+
+// Scope is a view of a bus restricted to the topics starting with a prefix,
+// so that a library embedded in a larger application can share its bus
+// without risking topic collisions.
+//
+// Topics passed to a Scope are prefixed before reaching the bus, and events
+// coming out of it, from queries or subscriptions, have the prefix removed
+// from their topic. Event IDs are those of the bus, so End, Start and the
+// lastID and fromID arguments work the same as on the bus.
+type Scope struct {
+	bus    *Bus
+	prefix string
+}
+
+// Scoped returns a Scope for the topics starting with prefix, which
+// typically ends with a separator, such as "billing.".
+func (b *Bus) Scoped(prefix string) *Scope {
+	return &Scope{bus: b, prefix: prefix}
+}
+
+// Scoped returns a Scope nested in s, whose topics start with both prefixes.
+func (s *Scope) Scoped(prefix string) *Scope {
+	return &Scope{bus: s.bus, prefix: s.prefix + prefix}
+}
+
+// Prefix returns the prefix of the scope's topics on the bus.
+func (s *Scope) Prefix() string {
+	return s.prefix
+}
+
+// topic returns the bus topic for a scope topic, keeping empty topics empty
+// so that they are rejected with ErrNoTopic.
+func (s *Scope) topic(topic string) string {
+	if topic == "" {
+		return ""
+	}
+	return s.prefix + topic
+}
+
+// query returns q with its topics prefixed. An empty Topic, or AllTopics,
+// selects every topic of the scope, and TopicPrefix is kept within it.
+func (s *Scope) query(q Query) Query {
+	if q.Topic == "" && len(q.Topics) == 0 || q.Topic == AllTopics {
+		q.Topic = AllTopics
+	}
+	q.Topic = s.topic(q.Topic)
+	q.TopicPrefix = s.prefix + q.TopicPrefix
+
+	topics := make([]string, len(q.Topics))
+	for i, topic := range q.Topics {
+		topics[i] = s.topic(topic)
+	}
+	q.Topics = topics
+
+	return q
+}
+
+// event returns e with the prefix removed from its topic.
+func (s *Scope) event(e Event) Event {
+	e.Topic = strings.TrimPrefix(e.Topic, s.prefix)
+	return e
+}
+
+// Publish is like Bus.Publish within the scope.
+func (s *Scope) Publish(topic, eventType string, payload any, lastID string) (string, error) {
+	return s.bus.Publish(s.topic(topic), eventType, payload, lastID)
+}
+
+// PublishExpecting is like Bus.PublishExpecting within the scope.
+func (s *Scope) PublishExpecting(topic, eventType string, payload any, expectedVersion int) (string, error) {
+	return s.bus.PublishExpecting(s.topic(topic), eventType, payload, expectedVersion)
+}
+
+// PublishUnstored is like Bus.PublishUnstored within the scope.
+func (s *Scope) PublishUnstored(topic, eventType string, payload any) error {
+	return s.bus.PublishUnstored(s.topic(topic), eventType, payload)
+}
+
+// Version is like Bus.Version within the scope.
+func (s *Scope) Version(topic string) int {
+	return s.bus.Version(s.topic(topic))
+}
+
+// Start is like Bus.Start.
+func (s *Scope) Start() string {
+	return s.bus.Start()
+}
+
+// End is like Bus.End. It returns the last event of the bus, which may be
+// outside the scope, and is a valid lastID or fromID all the same.
+func (s *Scope) End() string {
+	return s.bus.End()
+}
+
+// EndOf is like Bus.EndOf within the scope.
+func (s *Scope) EndOf(topic string) string {
+	return s.bus.EndOf(s.topic(topic))
+}
+
+// ForEachEvent is like Bus.ForEachEvent within the scope. Query.TopicRegexp
+// is matched against the topics of the bus, prefix included.
+func (s *Scope) ForEachEvent(q Query, fn func(Event)) {
+	s.bus.ForEachEvent(s.query(q), func(e Event) {
+		fn(s.event(e))
+	})
+}
+
+// Subscribe is like Bus.Subscribe within the scope.
+func (s *Scope) Subscribe(topic string, fromID string, opts ...SubscribeOption) (*Subscription, error) {
+	if topic == "" {
+		return nil, ErrNoTopic
+	}
+
+	return s.SubscribeQuery(Query{Topic: topic, AfterID: fromID}, opts...)
+}
+
+// SubscribeQuery is like Bus.SubscribeQuery within the scope.
+// Query.TopicRegexp is matched against the topics of the bus, prefix
+// included.
+//
+// Events go through a goroutine that removes the prefix from their topic,
+// which holds one event on top of the subscription buffer. Once the
+// subscription is closed, the events the consumer has yet to receive are
+// discarded, so that the goroutine ends even if nobody reads them.
+func (s *Scope) SubscribeQuery(q Query, opts ...SubscribeOption) (*Subscription, error) {
+	sub, err := s.bus.SubscribeQuery(s.query(q), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan Event)
+	done := make(chan struct{})
+	go func(in <-chan Event) {
+		defer close(ch)
+		for e := range in {
+			select {
+			case ch <- s.event(e):
+			case <-done:
+				// let the channel of the bus close
+				for range in {
+				}
+				return
+			}
+		}
+	}(sub.C)
+
+	var once sync.Once
+	scoped := *sub
+	scoped.C = ch
+	scoped.Close = func() {
+		sub.Close()
+		once.Do(func() { close(done) })
+	}
+
+	return &scoped, nil
+}
@@ -0,0 +1,125 @@
+package eventbus
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// sessionPoll is how often Session.Wait checks whether a bus caught up.
+const sessionPoll = 10 * time.Millisecond
+
+// Session gives a caller, such as the user of a web application,
+// read-your-writes consistency: it remembers the events the caller
+// published, and its reads wait until the bus they read from holds them.
+//
+// Reading from the bus the session publishes to never waits. Waiting matters
+// when reads are served by a replica that copies the log with its IDs, for
+// instance by loading dumps of the primary, and may be behind.
+//
+// A Session is safe for concurrent use.
+type Session struct {
+	bus *Bus
+
+	mu  sync.Mutex
+	seq uint64
+}
+
+// NewSession returns a session publishing to b.
+func NewSession(b *Bus) *Session {
+	return &Session{bus: b}
+}
+
+// Publish is like Bus.Publish, and records the published event.
+func (s *Session) Publish(topic, eventType string, payload any, lastID string) (string, error) {
+	id, err := s.bus.Publish(topic, eventType, payload, lastID)
+	if err != nil {
+		return "", err
+	}
+
+	s.Observe(id)
+	return id, nil
+}
+
+// Observe records an event published on behalf of the session by other
+// means, such as a transaction or a remote bus, so that reads include it.
+func (s *Session) Observe(id string) {
+	seq, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq = max(s.seq, seq)
+}
+
+// LastID returns the ID of the latest event recorded by the session, or the
+// empty string if there is none.
+func (s *Session) LastID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.seq == 0 {
+		return ""
+	}
+	return strconv.FormatUint(s.seq, 10)
+}
+
+// Wait blocks until r holds every event recorded by the session, or until
+// ctx is done, in which case it returns the context's error.
+func (s *Session) Wait(ctx context.Context, r *Bus) error {
+	s.mu.Lock()
+	seq := s.seq
+	s.mu.Unlock()
+
+	if r.reached(seq) {
+		return nil
+	}
+
+	ticker := time.NewTicker(sessionPoll)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if r.reached(seq) {
+				return nil
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// ForEachEvent waits for r to catch up with the session, like Wait, then
+// calls fn with each event of r that matches q, like Bus.ForEachEvent.
+func (s *Session) ForEachEvent(ctx context.Context, r *Bus, q Query, fn func(Event)) error {
+	if err := s.Wait(ctx, r); err != nil {
+		return err
+	}
+
+	r.ForEachEvent(q, fn)
+	return nil
+}
+
+// SubscribeQuery waits for r to catch up with the session, like Wait, then
+// subscribes to the events of r that match q, like Bus.SubscribeQuery, so
+// that the replay includes the events of the session.
+func (s *Session) SubscribeQuery(ctx context.Context, r *Bus, q Query, opts ...SubscribeOption) (*Subscription, error) {
+	if err := s.Wait(ctx, r); err != nil {
+		return nil, err
+	}
+
+	return r.SubscribeQuery(q, opts...)
+}
+
+// reached reports whether the log has been appended up to seq.
+func (b *Bus) reached(seq uint64) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.seq >= seq
+}
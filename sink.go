@@ -0,0 +1,271 @@
+package eventbus
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SinkConfig configures a Sink.
+type SinkConfig struct {
+	// MaxEvents flushes the batch once it holds that many events.
+	// Zero defaults to 100.
+	MaxEvents int
+
+	// Interval flushes the batch once its oldest event has waited that long,
+	// and is also the delay before retrying a failed write.
+	// Zero defaults to one second.
+	Interval time.Duration
+
+	// Checkpoints, if not nil, stores the ID of the last event written under
+	// the sink's name, so that a restarted sink resumes after it instead of
+	// q.AfterID.
+	Checkpoints CheckpointStore
+
+	// ShutdownPriority orders the sink during Shutdown, like
+	// WithShutdownPriority. Shutdown waits for the sink to write its last
+	// batch before closing subscriptions of higher priority.
+	ShutdownPriority int
+}
+
+// SinkStats reports what a Sink has written.
+type SinkStats struct {
+	Name string
+
+	// Events and Batches count what was written successfully.
+	Events  uint64
+	Batches uint64
+
+	// Failures counts the writes that returned an error and were retried.
+	Failures uint64
+
+	// Pending is the number of events waiting for the next write.
+	Pending int
+}
+
+// Sink writes the events matching a query to an external system in batches,
+// such as an analytics database that favors bulk inserts.
+type Sink struct {
+	bus   *Bus
+	name  string
+	q     Query
+	cfg   SinkConfig
+	write func([]Event) error
+	sub   *Subscription
+	stop  chan struct{}
+	done  chan struct{}
+	once  sync.Once
+
+	// lastID is the ID of the last event added to the batch, from which the
+	// sink resubscribes when its subscription drops events.
+	lastID string
+
+	mu    sync.Mutex
+	batch []Event
+	stats SinkStats
+}
+
+// Sink starts a sink named name that calls write with batches of the events
+// matching q, in log order.
+//
+// Delivery is at least once. A batch is only discarded once write returns
+// nil; otherwise it is retried after cfg.Interval, with the events that came
+// in the meantime. If the sink falls behind and its subscription drops
+// events, it resubscribes from the last event it received instead of losing
+// them. With cfg.Checkpoints, a restarted sink resumes after the last batch
+// written, so a batch interrupted by a crash is written again: write should
+// tolerate duplicates, for instance by using event IDs as keys.
+//
+// The sink runs until Close is called on it or on the bus.
+func (b *Bus) Sink(name string, q Query, cfg SinkConfig, write func([]Event) error) (*Sink, error) {
+	if cfg.MaxEvents <= 0 {
+		cfg.MaxEvents = 100
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+
+	s := &Sink{
+		bus:   b,
+		name:  name,
+		q:     q,
+		cfg:   cfg,
+		write: write,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+		stats: SinkStats{Name: name},
+	}
+
+	if cfg.Checkpoints != nil {
+		cp, err := cfg.Checkpoints.Load(name)
+		if err != nil {
+			return nil, err
+		}
+		if cp.LastID != "" {
+			s.q.AfterID = cp.LastID
+		}
+	}
+	s.lastID = s.q.AfterID
+
+	sub, err := b.SubscribeQuery(s.q, s.options()...)
+	if err != nil {
+		return nil, err
+	}
+	s.sub = sub
+
+	go s.run()
+
+	return s, nil
+}
+
+func (s *Sink) run() {
+	defer close(s.done)
+
+	timer := time.NewTimer(s.cfg.Interval)
+	timer.Stop()
+	defer timer.Stop()
+
+	// failing is set while a failed batch waits for the timer to be retried
+	failing := false
+
+	for {
+		select {
+		case e, ok := <-s.sub.C:
+			if !ok {
+				s.flush()
+				return
+			}
+
+			if s.sub.Dropped() > 0 {
+				// e may come after a gap: replay from the last event kept
+				if !s.resubscribe() {
+					s.flush()
+					return
+				}
+				continue
+			}
+
+			n := s.add(e)
+			if failing {
+				continue
+			}
+			if n == 1 {
+				timer.Reset(s.cfg.Interval)
+			}
+			if n >= s.cfg.MaxEvents && !s.flush() {
+				failing = true
+				timer.Reset(s.cfg.Interval)
+			}
+
+		case <-timer.C:
+			failing = !s.flush()
+			if failing {
+				timer.Reset(s.cfg.Interval)
+			}
+
+		case <-s.stop:
+			s.sub.Close()
+			s.flush()
+			return
+		}
+	}
+}
+
+// add appends e to the batch and returns the size of the batch.
+func (s *Sink) add(e Event) int {
+	if e.ID != "" {
+		s.lastID = e.ID
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.batch = append(s.batch, e)
+	s.stats.Pending = len(s.batch)
+
+	return len(s.batch)
+}
+
+// resubscribe replaces the subscription with one starting after the last
+// event added to the batch. It reports false if the bus is closed.
+func (s *Sink) resubscribe() bool {
+	s.sub.Close()
+
+	q := s.q
+	q.AfterID = s.lastID
+
+	sub, err := s.bus.SubscribeQuery(q, s.options()...)
+	if err != nil {
+		return false
+	}
+	s.sub = sub
+
+	return true
+}
+
+// options returns the options of the sink's subscriptions.
+func (s *Sink) options() []SubscribeOption {
+	return []SubscribeOption{
+		WithName(s.name),
+		WithShutdownPriority(s.cfg.ShutdownPriority),
+		func(sub *subscriber) { sub.finished = s.done },
+	}
+}
+
+// flush writes the pending batch and reports whether it succeeded. Only the
+// run goroutine writes, so batches never overlap.
+func (s *Sink) flush() bool {
+	s.mu.Lock()
+	batch := s.batch
+	s.mu.Unlock()
+
+	if len(batch) == 0 {
+		return true
+	}
+
+	if err := s.call(batch); err != nil {
+		s.mu.Lock()
+		s.stats.Failures++
+		s.mu.Unlock()
+		return false
+	}
+
+	s.mu.Lock()
+	s.batch = s.batch[len(batch):]
+	s.stats.Events += uint64(len(batch))
+	s.stats.Batches++
+	s.stats.Pending = len(s.batch)
+	s.mu.Unlock()
+
+	if s.cfg.Checkpoints != nil && s.lastID != "" {
+		// a failed save only means a batch may be written twice
+		s.cfg.Checkpoints.Save(s.name, Checkpoint{LastID: s.lastID})
+	}
+
+	return true
+}
+
+// call runs write and turns a panic into an error.
+func (s *Sink) call(batch []Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("eventbus: sink panic: %v", r)
+		}
+	}()
+
+	return s.write(batch)
+}
+
+// Stats returns a snapshot of the sink's statistics.
+func (s *Sink) Stats() SinkStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.stats
+}
+
+// Close stops the sink after a last attempt at writing the pending batch.
+func (s *Sink) Close() {
+	s.once.Do(func() { close(s.stop) })
+	<-s.done
+}
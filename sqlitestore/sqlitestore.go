@@ -0,0 +1,261 @@
+// Package sqlitestore implements eventbus.Store on SQLite, for durable and
+// queryable storage without extra infrastructure.
+//
+// It works through database/sql and does not import a driver itself, so that
+// applications pick one, with or without cgo:
+//
+//	import _ "modernc.org/sqlite"
+//
+//	db, err := sql.Open("sqlite", "events.db")
+//	...
+//	store, err := sqlitestore.Open(db)
+//	...
+//	bus, err := eventbus.NewWithStore(store)
+//
+// Events are stored in an events table, with their topic, type and
+// timestamp in indexed columns, and the whole event as JSON. Payloads are
+// recovered as generic JSON values, as with eventbus.Load.
+package sqlitestore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lobre/eventbus"
+)
+
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS events (
+		seq       INTEGER PRIMARY KEY,
+		id        TEXT    NOT NULL UNIQUE,
+		topic     TEXT    NOT NULL,
+		type      TEXT    NOT NULL,
+		timestamp INTEGER NOT NULL,
+		data      TEXT    NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS events_topic ON events (topic, seq)`,
+	`CREATE INDEX IF NOT EXISTS events_type ON events (type, seq)`,
+	`CREATE INDEX IF NOT EXISTS events_timestamp ON events (timestamp)`,
+}
+
+// Store is an eventbus.Store backed by a SQLite database.
+type Store struct {
+	db *sql.DB
+
+	mu     sync.Mutex
+	lastID string
+	n      int
+}
+
+// Open creates the events table in db if needed, and returns a Store using
+// it. The caller keeps ownership of db and closes it after the bus.
+func Open(db *sql.DB) (*Store, error) {
+	for _, stmt := range schema {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, fmt.Errorf("sqlitestore: create schema: %w", err)
+		}
+	}
+
+	s := &Store{db: db}
+	var lastID sql.NullString
+	err := db.QueryRow(`SELECT count(*), (SELECT id FROM events ORDER BY seq DESC LIMIT 1) FROM events`).Scan(&s.n, &lastID)
+	if err != nil {
+		return nil, err
+	}
+	s.lastID = lastID.String
+
+	return s, nil
+}
+
+// Append implements eventbus.Store. Events are inserted in a single
+// transaction.
+func (s *Store) Append(events ...eventbus.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO events (seq, id, topic, type, timestamp, data) VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, e := range events {
+		seq, err := strconv.ParseUint(e.ID, 10, 64)
+		if err != nil {
+			return fmt.Errorf("sqlitestore: invalid id %q", e.ID)
+		}
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+
+		if _, err := stmt.Exec(int64(seq), e.ID, e.Topic, e.Type, e.Timestamp.UnixNano(), string(data)); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.lastID = events[len(events)-1].ID
+	s.n += len(events)
+
+	return nil
+}
+
+// ReadAfter implements eventbus.Store.
+func (s *Store) ReadAfter(id string, fn func(eventbus.Event) error) error {
+	after, err := seqOf(id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := s.db.Query(`SELECT data FROM events WHERE seq > ? ORDER BY seq`, after)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scan(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// LastID implements eventbus.Store.
+func (s *Store) LastID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lastID
+}
+
+// Len implements eventbus.Store.
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.n
+}
+
+// Events returns the stored events that match q, straight from the
+// database, including those the bus removed from memory. A single topic,
+// a single type, Since, Until, AfterID, BeforeID and Reverse are pushed down
+// to SQL and its indexes; the other filters of q are then applied to the
+// rows, as well as Offset and Limit. Expired events are skipped.
+func (s *Store) Events(q eventbus.Query) ([]eventbus.Event, error) {
+	where, args := "1 = 1", []any(nil)
+	and := func(cond string, arg any) {
+		where += " AND " + cond
+		args = append(args, arg)
+	}
+
+	if q.Topic != "" && q.Topic != eventbus.AllTopics && len(q.Topics) == 0 && !strings.Contains(q.Topic, "*") {
+		and("topic = ?", q.Topic)
+	}
+	if q.Type != "" && len(q.Types) == 0 {
+		and("type = ?", q.Type)
+	}
+	if !q.Since.IsZero() {
+		and("timestamp > ?", q.Since.UnixNano())
+	}
+	if !q.Until.IsZero() {
+		and("timestamp < ?", q.Until.UnixNano())
+	}
+	if q.AfterID != "" {
+		after, err := seqOf(q.AfterID)
+		if err != nil {
+			return nil, err
+		}
+		and("seq > ?", after)
+	}
+	if q.BeforeID != "" {
+		before, err := seqOf(q.BeforeID)
+		if err != nil {
+			return nil, err
+		}
+		and("seq < ?", before)
+	}
+
+	order := "ASC"
+	if q.Reverse {
+		order = "DESC"
+	}
+
+	rows, err := s.db.Query(`SELECT data FROM events WHERE `+where+` ORDER BY seq `+order, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []eventbus.Event
+	now := time.Now()
+	skip := q.Offset
+	for rows.Next() {
+		e, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		if !e.ExpiresAt.IsZero() && !now.Before(e.ExpiresAt) || !q.Match(e) {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+
+		events = append(events, e)
+		if len(events) == q.Limit {
+			break
+		}
+	}
+
+	return events, rows.Err()
+}
+
+func scan(rows *sql.Rows) (eventbus.Event, error) {
+	var data string
+	if err := rows.Scan(&data); err != nil {
+		return eventbus.Event{}, err
+	}
+
+	var e eventbus.Event
+	err := json.Unmarshal([]byte(data), &e)
+	return e, err
+}
+
+// seqOf returns the sequence number of an event ID, 0 for the empty string.
+func seqOf(id string) (int64, error) {
+	if id == "" {
+		return 0, nil
+	}
+
+	seq, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("sqlitestore: invalid id %q", id)
+	}
+	return int64(seq), nil
+}
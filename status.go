@@ -0,0 +1,78 @@
+package eventbus
+
+// Kinds of Status.
+const (
+	// StatusDropped is an event dropped because the subscription's buffer
+	// was full. Status.Event is the event.
+	StatusDropped = "dropped"
+
+	// StatusTrimmed reports that events the subscription had not received
+	// yet were removed by retention or TruncateBefore, so it missed them.
+	StatusTrimmed = "trimmed"
+
+	// StatusParked is an event parked because of WithParking. Status.Event
+	// is the event.
+	StatusParked = "parked"
+
+	// StatusClosed reports that the subscription is closing. Status.Err is
+	// nil when Close was called, and ErrClosed when the bus was closed or
+	// shut down.
+	StatusClosed = "closed"
+)
+
+// Status is a lifecycle notification of a subscription, see WithStatus.
+type Status struct {
+	Kind  string
+	Event Event
+	Err   error
+}
+
+// WithStatus registers fn to be called with the lifecycle notifications of
+// the subscription: dropped and parked events, history trimmed before it was
+// received, and the reason the subscription closes, which the closing of the
+// channel alone does not tell.
+//
+// Like with WithOnDrop, fn is called synchronously while the bus lock is
+// held, so it must be fast and must not call back into the bus.
+func WithStatus(fn func(Status)) SubscribeOption {
+	return func(s *subscriber) {
+		s.onStatus = fn
+	}
+}
+
+// Err returns why the subscription closed: nil if it is open or Close was
+// called, and ErrClosed if the bus was closed or shut down.
+func (s *Subscription) Err() error {
+	s.bus.mu.RLock()
+	defer s.bus.mu.RUnlock()
+
+	return s.sub.err
+}
+
+// notify calls the status callback of the subscriber, if any.
+func (s *subscriber) notify(st Status) {
+	if s.onStatus != nil {
+		s.onStatus(st)
+	}
+}
+
+// closing records why the subscriber is closing and notifies it. It must be
+// called with the bus lock held.
+func (s *subscriber) closing(err error) {
+	s.err = err
+	s.notify(Status{Kind: StatusClosed, Err: err})
+	s.wake()
+}
+
+// trimmed notifies the subscriber that history after its position was
+// removed, when trimmed is true, once per position. It must be called with
+// the bus lock held.
+func (s *subscriber) trimmed(trimmed bool) {
+	if !trimmed || s.trimmedAt != nil && *s.trimmedAt == s.lastID {
+		return
+	}
+
+	at := s.lastID
+	s.trimmedAt = &at
+	s.notify(Status{Kind: StatusTrimmed})
+}
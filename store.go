@@ -0,0 +1,180 @@
+package eventbus
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Store keeps the events of a bus outside of its in-memory log, such as on
+// disk or in a database, so that they survive a restart. The bus keeps
+// serving reads from memory, and writes every stored event through its Store
+// before appending it, as set up by NewWithStore.
+//
+// Implementations are called with the bus lock held, one call at a time, so
+// they do not need to be safe for concurrent use by the bus, but must not
+// call back into it.
+//
+// Stores with dependencies, such as boltstore and pebblestore, live in
+// modules of their own, so that the bus has none.
+type Store interface {
+	// Append stores events after the events already stored, all or none.
+	// The bus does not append them to its log if Append returns an error.
+	// The bus never calls it without events, but implementations should
+	// then do nothing.
+	Append(events ...Event) error
+
+	// ReadAfter calls fn with each stored event after the event with the
+	// given ID, or from the first one if id is empty, in the order they
+	// were appended, and stops at the first error fn returns.
+	ReadAfter(id string, fn func(Event) error) error
+
+	// LastID returns the ID of the last stored event, or the empty string
+	// if there is none.
+	LastID() string
+
+	// Len returns the number of stored events.
+	Len() int
+}
+
+// NewWithStore creates a Bus whose log is written through s, after
+// recovering the events s already holds, so that a restarted process picks
+// up where it stopped.
+//
+// Every publish is written through synchronously: Publish, Commit and the
+// other appends return once s.Append has, and subscribers only ever see
+// events s accepted. With a store that syncs each append, such as a WAL in
+// SyncAlways mode, each published event is durable, rather than only as
+// recent as the last SaveToFile.
+//
+// Only appends reach the store: events removed from memory by retention or
+// TruncateBefore stay in it, and come back on the next start, until retention
+// removes them again. Load and the other loading methods return ErrHasStore.
+// The bus does not close s, which should be closed after the bus.
+//
+// The bus holds the whole recovered log in memory: for histories larger than
+// memory, see NewWithStoreSince.
+func NewWithStore(s Store) (*Bus, error) {
+	return NewWithStoreSince(s, time.Time{})
+}
+
+// NewWithStoreSince is like NewWithStore, but only keeps in memory the
+// events of s from the first one published at or after since, so that the
+// history can be larger than memory. Older events are left in the store, to
+// be read from it, such as with the Events method of the pebblestore
+// module, and the bus behaves as if TruncateBefore had removed them: topic
+// versions and IDs carry on from the whole history.
+//
+// Recovery still reads every stored event once, without keeping the older
+// ones.
+func NewWithStoreSince(s Store, since time.Time) (*Bus, error) {
+	b, err := recoverStore(s, since)
+	if err != nil {
+		return nil, err
+	}
+	b.store = s
+
+	return b, nil
+}
+
+// recoverStore returns a new bus holding the events of s from the first one
+// published at or after since, without writing to it.
+func recoverStore(s Store, since time.Time) (*Bus, error) {
+	b := New()
+
+	var last string
+	err := s.ReadAfter("", func(e Event) error {
+		last = e.ID
+		b.versions[e.Topic] = e.Version
+		if len(b.events) > 0 || !e.Timestamp.Before(since) {
+			b.events = append(b.events, e)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if last != "" {
+		seq, err := strconv.ParseUint(last, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("eventbus: invalid id %q", last)
+		}
+		b.seq = seq
+
+		// events before the first recovered one are gone from memory
+		first := seq + 1
+		if len(b.events) > 0 {
+			first, _ = strconv.ParseUint(b.events[0].ID, 10, 64)
+		}
+		if first > 1 {
+			b.trimmedSeq = first - 1
+			b.truncatedSeq = first - 1
+		}
+	}
+	b.reindex()
+
+	return b, nil
+}
+
+// MemoryStore is a Store that keeps events in memory, mostly useful in tests
+// and as a reference for other implementations. It is safe for concurrent
+// use.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	events []Event
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// Append implements Store.
+func (s *MemoryStore) Append(events ...Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events = append(s.events, events...)
+	return nil
+}
+
+// ReadAfter implements Store.
+func (s *MemoryStore) ReadAfter(id string, fn func(Event) error) error {
+	s.mu.RLock()
+	events := s.events
+	s.mu.RUnlock()
+
+	start := 0
+	if id != "" {
+		start = searchAfter(events, seqOf(id))
+	}
+
+	for _, e := range events[start:] {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LastID implements Store.
+func (s *MemoryStore) LastID() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.events) == 0 {
+		return ""
+	}
+	return s.events[len(s.events)-1].ID
+}
+
+// Len implements Store.
+func (s *MemoryStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.events)
+}
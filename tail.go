@@ -0,0 +1,44 @@
+package eventbus
+
+import "context"
+
+// Tail calls fn with each event matching q, first those already in the log
+// after q.AfterID, then new ones as they are published, until ctx is done.
+//
+// There is no gap between history and live events, and none when fn falls
+// behind: if live events are dropped, Tail resumes after the last event
+// passed to fn. fn is called for one event at a time, from the calling
+// goroutine. Tail returns nil when ctx is done, ErrClosed if the bus is
+// closed, and ErrUnknownCursor if q.AfterID is unknown.
+func (b *Bus) Tail(ctx context.Context, q Query, fn func(Event)) error {
+	sub, err := b.SubscribeQuery(q)
+	if err != nil {
+		return err
+	}
+	defer func() { sub.Close() }()
+
+	for {
+		select {
+		case e, ok := <-sub.C:
+			if !ok {
+				return ErrClosed
+			}
+			if sub.Dropped() > 0 {
+				// e may come after a gap: replay from the last event passed to fn
+				sub.Close()
+				if sub, err = b.SubscribeQuery(q); err != nil {
+					return err
+				}
+				continue
+			}
+
+			fn(e)
+			if e.ID != "" {
+				q.AfterID = e.ID
+			}
+
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package eventbus
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+)
+
+// TopicSet is a subscription to a set of topics that changes over time, for
+// servers following thousands of per-aggregate topics with a single channel
+// instead of a subscription each.
+//
+// Topics are added and removed in bulk, each with its own cursor: the ID of
+// the last event of the topic sent on the channel. Like a subscription,
+// adding a topic replays its history after its cursor without gaps before
+// its live events, and never sends an event twice.
+type TopicSet struct {
+	*Subscription
+}
+
+// SubscribeTopicSet returns a subscription to an empty set of topics, to be
+// filled with Add. Options apply as for Subscribe, except WithGroup.
+func (b *Bus) SubscribeTopicSet(opts ...SubscribeOption) (*TopicSet, error) {
+	opts = append(opts, func(s *subscriber) {
+		s.topics = make(map[string]uint64)
+		s.group = ""
+	})
+
+	sub, err := b.subscribe(Query{Topic: AllTopics, AfterID: b.End()}, 1024, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TopicSet{sub}, nil
+}
+
+// Add adds topics to the set, mapping each to the cursor to replay it from:
+// the empty string, or Start, for its whole history, and End for live
+// events only. Topics already in the set keep their cursor.
+//
+// If a topic is empty, Add returns ErrNoTopic, and if a cursor does not
+// exist in the log, it returns ErrUnknownCursor, and adds nothing.
+func (t *TopicSet) Add(cursors map[string]string) error {
+	b, sub := t.bus, t.sub
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for topic, cursor := range cursors {
+		if topic == "" {
+			return ErrNoTopic
+		}
+		if _, ok, _ := b.start(cursor); !ok {
+			return ErrUnknownCursor
+		}
+	}
+
+	if _, ok := b.subscribers[sub]; !ok {
+		return ErrClosed
+	}
+
+	from := seqOf(sub.lastID)
+	for topic, cursor := range cursors {
+		if _, ok := sub.topics[topic]; ok {
+			continue
+		}
+
+		seq := seqOf(cursor)
+		sub.topics[topic] = seq
+		if seq < from {
+			// catching up from there replays the new topic, while the
+			// cursors of the others skip what they were already sent
+			from = seq
+			sub.lastID = cursor
+		}
+	}
+
+	if sub.paused || sub.pumping {
+		// Resume or the pump catches up from lastID
+		return nil
+	}
+	if start, ok, trimmed := b.start(sub.lastID); ok {
+		sub.trimmed(trimmed)
+		if _, full := b.catchUp(sub, start); full {
+			go b.pump(sub)
+		}
+	}
+
+	return nil
+}
+
+// Remove removes topics from the set. Events of those topics already in the
+// channel buffer are still received.
+func (t *TopicSet) Remove(topics ...string) {
+	t.bus.mu.Lock()
+	defer t.bus.mu.Unlock()
+
+	for _, topic := range topics {
+		delete(t.sub.topics, topic)
+	}
+}
+
+// Cursors returns the topics of the set, each with the ID of its last event
+// sent on the channel, or the cursor it was added with if there is none yet.
+// After a restart, passing them to Add resumes every topic where it was.
+func (t *TopicSet) Cursors() map[string]string {
+	t.bus.mu.RLock()
+	defer t.bus.mu.RUnlock()
+
+	cursors := make(map[string]string, len(t.sub.topics))
+	for topic, seq := range t.sub.topics {
+		cursors[topic] = ""
+		if seq > 0 {
+			cursors[topic] = strconv.FormatUint(seq, 10)
+		}
+	}
+
+	return cursors
+}
+
+// Topics returns the topics of the set, in no particular order.
+func (t *TopicSet) Topics() []string {
+	t.bus.mu.RLock()
+	defer t.bus.mu.RUnlock()
+
+	return slices.Collect(maps.Keys(t.sub.topics))
+}
+
+// match reports whether e is for the subscriber: it must match its query
+// and, for a topic set, be a topic of the set after its cursor.
+func (s *subscriber) match(e Event) bool {
+	if s.topics != nil {
+		cursor, ok := s.topics[e.Topic]
+		if !ok || e.ID != "" && seqOf(e.ID) <= cursor {
+			return false
+		}
+	}
+
+	return s.query.match(e)
+}
+
+// seqOf returns the sequence number of an event ID, 0 for the empty string.
+func seqOf(id string) uint64 {
+	seq, _ := strconv.ParseUint(id, 10, 64)
+	return seq
+}
@@ -0,0 +1,122 @@
+package eventbus
+
+import "time"
+
+// Fan-out operations found in TopicTraceEntry.Op, in addition to the trace
+// operations of Record.
+const (
+	// TraceDeliver is an event sent to a subscriber.
+	TraceDeliver = "deliver"
+
+	// TraceDrop is an event dropped because the subscriber's buffer was full.
+	TraceDrop = "drop"
+
+	// TraceSkip is an event not sent to a matching subscriber because it was
+	// paused or still catching up with history.
+	TraceSkip = "skip"
+
+	// TraceFailed is an event the bus could not append because its store
+	// returned an error, such as a due scheduled event or a quota warning.
+	TraceFailed = "failed"
+
+	// TraceVetoed is an event published by the bus itself, such as a due
+	// scheduled event or a quota warning, that a validator or a PreCommit
+	// hook rejected.
+	TraceVetoed = "vetoed"
+)
+
+// TopicTraceEntry is one operation recorded by TraceTopic.
+type TopicTraceEntry struct {
+	Time    time.Time `json:"time"`
+	Op      string    `json:"op"`
+	Topic   string    `json:"topic"`
+	Type    string    `json:"type"`
+	EventID string    `json:"event_id,omitempty"`
+
+	// Subscriber identifies the subscriber of fan-out operations, and
+	// SubscriberName is its name, see WithName.
+	Subscriber     uint64 `json:"subscriber,omitempty"`
+	SubscriberName string `json:"subscriber_name,omitempty"`
+}
+
+// topicTrace keeps the latest entries traced for a topic.
+type topicTrace struct {
+	limit   int
+	entries []TopicTraceEntry
+}
+
+// TraceTopic starts recording, for the topics matching pattern, every append,
+// conflict, failed or vetoed append and unstored event, and how each event
+// was fanned out to subscribers: delivered, dropped or skipped. Only the
+// latest limit entries are kept, so tracing can be left on for a misbehaving
+// stream in production; a limit of 0 or less keeps 1000 entries.
+//
+// Tracing again a pattern that is already traced starts over.
+func (b *Bus) TraceTopic(pattern string, limit int) error {
+	if pattern == "" {
+		return ErrNoTopic
+	}
+	if limit <= 0 {
+		limit = 1000
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.traces[pattern] = &topicTrace{limit: limit}
+	return nil
+}
+
+// UntraceTopic stops tracing a pattern and discards its entries.
+func (b *Bus) UntraceTopic(pattern string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.traces, pattern)
+}
+
+// TopicTrace returns the entries recorded for a pattern traced with
+// TraceTopic, oldest first, or nil if the pattern is not traced.
+func (b *Bus) TopicTrace(pattern string) []TopicTraceEntry {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	t, ok := b.traces[pattern]
+	if !ok {
+		return nil
+	}
+
+	return append([]TopicTraceEntry(nil), t.entries...)
+}
+
+// traceTopic records op for e in the traces of the patterns matching its
+// topic. sub is the subscriber of fan-out operations, nil otherwise. It must
+// be called with b.mu held.
+func (b *Bus) traceTopic(op string, e Event, sub *subscriber) {
+	if len(b.traces) == 0 {
+		return
+	}
+
+	for pattern, t := range b.traces {
+		if !matchTopic(pattern, e.Topic) {
+			continue
+		}
+
+		entry := TopicTraceEntry{
+			Time:    time.Now().UTC(),
+			Op:      op,
+			Topic:   e.Topic,
+			Type:    e.Type,
+			EventID: e.ID,
+		}
+		if sub != nil {
+			entry.Subscriber = sub.id
+			entry.SubscriberName = sub.name
+		}
+
+		if len(t.entries) == t.limit {
+			t.entries = append(t.entries[:0], t.entries[1:]...)
+		}
+		t.entries = append(t.entries, entry)
+	}
+}
@@ -0,0 +1,173 @@
+package eventbus
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// Trace operations, as found in TraceEntry.Op.
+const (
+	// TraceAppend is an event appended to the log.
+	TraceAppend = "append"
+
+	// TraceUnstored is an event delivered with PublishUnstored.
+	TraceUnstored = "unstored"
+
+	// TraceConflict is a Publish rejected with ErrConflict.
+	TraceConflict = "conflict"
+)
+
+// TraceEntry is one operation recorded by Record.
+type TraceEntry struct {
+	// Offset is the time elapsed since the recording started.
+	Offset time.Duration `json:"offset"`
+
+	// Goroutine identifies the goroutine that performed the operation. It is
+	// only a hint to understand interleavings and plays no part in replay.
+	Goroutine uint64 `json:"goroutine,omitempty"`
+
+	Op     string `json:"op"`
+	Event  Event  `json:"event"`
+	LastID string `json:"last_id,omitempty"`
+}
+
+// ErrTraceDiverged is returned when replaying a trace does not lead to the
+// same outcome as the recording.
+var ErrTraceDiverged = errors.New("eventbus: trace diverged")
+
+type recorder struct {
+	enc   *json.Encoder
+	start time.Time
+	err   error
+}
+
+// Record writes every append, unstored delivery and publish conflict of the
+// bus to w as newline-delimited JSON TraceEntry values, in the order the bus
+// performed them, until the returned stop function is called. stop returns
+// the first write error, if any.
+//
+// Entries are written while the bus lock is held, which gives an exact order
+// but slows publishers down: Record is meant for reproducing bugs, not for
+// normal operation. Starting a recording replaces the previous one.
+func (b *Bus) Record(w io.Writer) (stop func() error) {
+	rec := &recorder{enc: json.NewEncoder(w), start: time.Now()}
+
+	b.mu.Lock()
+	b.recorder = rec
+	b.mu.Unlock()
+
+	return func() error {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if b.recorder == rec {
+			b.recorder = nil
+		}
+		return rec.err
+	}
+}
+
+// record writes an entry if a recording is running. It must be called with
+// b.mu held.
+func (b *Bus) record(op string, e Event, lastID string) {
+	rec := b.recorder
+	if rec == nil || rec.err != nil {
+		return
+	}
+
+	rec.err = rec.enc.Encode(TraceEntry{
+		Offset:    time.Since(rec.start),
+		Goroutine: goroutineID(),
+		Op:        op,
+		Event:     e,
+		LastID:    lastID,
+	})
+}
+
+// goroutineID extracts the current goroutine ID from the stack header, which
+// looks like "goroutine 42 [running]:".
+func goroutineID() uint64 {
+	var buf [64]byte
+	n := runtime.Stack(buf[:], false)
+
+	field, _, _ := bytes.Cut(bytes.TrimPrefix(buf[:n], []byte("goroutine ")), []byte(" "))
+	id, _ := strconv.ParseUint(string(field), 10, 64)
+
+	return id
+}
+
+// Replayer replays a trace written by Record against a bus, one entry at a
+// time, so that a test can reproduce the exact sequence of operations that
+// led to a bug, and interleave its own checks between steps.
+type Replayer struct {
+	bus *Bus
+	dec *json.Decoder
+	n   int
+}
+
+// NewReplayer creates a Replayer that reads a trace from r and applies it to
+// b, which is typically a new bus.
+func NewReplayer(b *Bus, r io.Reader) *Replayer {
+	return &Replayer{bus: b, dec: json.NewDecoder(r)}
+}
+
+// Step applies the next entry of the trace and returns it. It returns io.EOF
+// at the end of the trace, and an error wrapping ErrTraceDiverged if the bus
+// does not behave as recorded, such as assigning another ID.
+//
+// Step does not wait for the recorded offsets: replay is driven by the
+// caller, which is what makes it deterministic.
+func (p *Replayer) Step() (TraceEntry, error) {
+	var entry TraceEntry
+	if err := p.dec.Decode(&entry); err != nil {
+		return entry, err
+	}
+	p.n++
+
+	e := entry.Event
+	id, err := "", error(nil)
+
+	switch entry.Op {
+	case TraceAppend:
+		e.ID = ""
+		id, err = p.bus.publishUnchecked(e)
+		if err == nil && id != entry.Event.ID {
+			err = fmt.Errorf("%w: entry %d: got id %q, want %q", ErrTraceDiverged, p.n, id, entry.Event.ID)
+		}
+
+	case TraceUnstored:
+		_, err = p.bus.publish(e, "", false)
+
+	case TraceConflict:
+		_, err = p.bus.publish(e, entry.LastID, true)
+		if err == nil {
+			err = fmt.Errorf("%w: entry %d: publish succeeded, want conflict", ErrTraceDiverged, p.n)
+		} else if errors.Is(err, ErrConflict) {
+			err = nil
+		}
+
+	default:
+		err = fmt.Errorf("eventbus: entry %d: unknown trace op %q", p.n, entry.Op)
+	}
+
+	return entry, err
+}
+
+// Run applies the remaining entries of the trace and stops at the first
+// error. Reaching the end of the trace is not an error.
+func (p *Replayer) Run() error {
+	for {
+		if _, err := p.Step(); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
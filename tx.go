@@ -0,0 +1,105 @@
+package eventbus
+
+import "time"
+
+// Tx groups events for several topics so they are appended atomically.
+//
+// A Tx is not safe for concurrent use. Events are only checked and appended
+// when Commit is called.
+type Tx struct {
+	bus     *Bus
+	appends []txAppend
+	done    bool
+}
+
+type txAppend struct {
+	event  Event
+	lastID string
+}
+
+// Begin starts a transaction on the bus.
+func (b *Bus) Begin() *Tx {
+	return &Tx{bus: b}
+}
+
+// Append adds an event to the transaction. lastID has the same meaning as in
+// Publish and is checked against the log when the transaction commits.
+func (tx *Tx) Append(topic, eventType string, payload any, lastID string) {
+	tx.appends = append(tx.appends, txAppend{
+		event: Event{
+			Topic:   topic,
+			Type:    eventType,
+			Payload: payload,
+		},
+		lastID: lastID,
+	})
+}
+
+// Commit appends all the events of the transaction, in order, or none of
+// them.
+//
+// Each lastID is checked against the log as it was before the transaction, so
+// several events for the same topic can share the same lastID. If any topic
+// has advanced, Commit returns ErrConflict. If any topic is empty, Commit
+// returns ErrNoTopic. A transaction can only be committed once; later calls
+// return ErrTxDone.
+//
+// On success, Commit returns the IDs assigned to the events, in the order
+// they were appended to the transaction.
+func (tx *Tx) Commit() ([]string, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+	tx.done = true
+
+	for _, a := range tx.appends {
+		if a.event.Topic == "" {
+			return nil, ErrNoTopic
+		}
+	}
+
+	b := tx.bus
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.writable(); err != nil {
+		return nil, err
+	}
+
+	for _, a := range tx.appends {
+		if b.advanced(a.event.Topic, a.lastID) {
+			return nil, ErrConflict
+		}
+	}
+	for _, a := range tx.appends {
+		if err := b.admit(a.event); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now().UTC()
+	events := make([]Event, len(tx.appends))
+	for i, a := range tx.appends {
+		events[i] = a.event
+		events[i].Timestamp = now
+	}
+
+	events, err := b.commit(events...)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(events))
+	for i, e := range events {
+		b.fanOut(e, false)
+		ids[i] = e.ID
+	}
+
+	return ids, nil
+}
+
+// Rollback discards the transaction. Nothing has been appended yet, so
+// Rollback only prevents a later Commit.
+func (tx *Tx) Rollback() {
+	tx.done = true
+}
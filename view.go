@@ -0,0 +1,181 @@
+package eventbus
+
+import (
+	"encoding/json"
+	"io"
+	"iter"
+	"strconv"
+	"time"
+)
+
+// View is an immutable, point-in-time view of the log, taken with Snapshot.
+//
+// A View is not affected by events published, trimmed or loaded after it was
+// taken, and reading from it does not hold the bus lock, so long-running reads
+// and backups do not slow down publishers.
+type View struct {
+	events     []Event
+	scheduled  []scheduled
+	trimmedSeq uint64
+	keyring    *Keyring
+}
+
+// Snapshot captures the current state of the log in a View.
+//
+// Taking a snapshot is cheap: the View shares the events already in the log,
+// which are never modified in place, and only events appended later are left
+// out.
+func (b *Bus) Snapshot() *View {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return &View{
+		// limit capacity so that later appends never touch the view
+		events:     b.events[:len(b.events):len(b.events)],
+		scheduled:  b.schedule.list(),
+		trimmedSeq: b.trimmedSeq,
+		keyring:    b.keyring,
+	}
+}
+
+// start returns the position of the first event strictly after id, with the
+// same rules as Bus.start, but without an index.
+func (v *View) start(id string) (int, bool) {
+	if id == "" {
+		return 0, true
+	}
+
+	seq, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		for i, e := range v.events {
+			if e.ID == id {
+				return i + 1, true
+			}
+		}
+		return 0, false
+	}
+
+	i := searchAfter(v.events, seq)
+	if i > 0 && v.events[i-1].ID == id {
+		return i, true
+	}
+	if seq <= v.trimmedSeq {
+		return i, true
+	}
+
+	return 0, false
+}
+
+// bound returns the position of the first event at or after id, with the
+// same rules as Bus.bound, but without an index.
+func (v *View) bound(id string) int {
+	if id == "" {
+		return len(v.events)
+	}
+
+	seq, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		for i, e := range v.events {
+			if e.ID == id {
+				return i
+			}
+		}
+		return 0
+	}
+	if seq == 0 {
+		return 0
+	}
+
+	return searchAfter(v.events, seq-1)
+}
+
+// ForEachEvent calls fn with each event of the view that matches q, like
+// Bus.ForEachEvent.
+func (v *View) ForEachEvent(q Query, fn func(Event)) {
+	for e := range v.Events(q) {
+		fn(e)
+	}
+}
+
+// Events returns an iterator over the events of the view that match q, like
+// Bus.Events. As the view is immutable, it reads them directly.
+func (v *View) Events(q Query) iter.Seq[Event] {
+	return func(yield func(Event) bool) {
+		start, ok := v.start(q.AfterID)
+		if !ok {
+			return
+		}
+
+		now := time.Now()
+		skip, n := q.Offset, 0
+		end := v.bound(q.BeforeID)
+		for i := range max(end-start, 0) {
+			e := v.events[q.index(start, end, i)]
+			if e.expired(now) || !q.match(e) {
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+
+			if !yield(e) {
+				return
+			}
+			if n++; n == q.Limit {
+				return
+			}
+		}
+	}
+}
+
+// Count returns the number of events of the view that match q, like
+// Bus.Count.
+func (v *View) Count(q Query) int {
+	n := 0
+	for range v.Events(q) {
+		n++
+	}
+	return n
+}
+
+// End returns the ID of the last event in the view, or the empty string if
+// the view is empty.
+func (v *View) End() string {
+	if len(v.events) == 0 {
+		return ""
+	}
+	return v.events[len(v.events)-1].ID
+}
+
+// Len returns the number of events in the view, expired ones included.
+func (v *View) Len() int {
+	return len(v.events)
+}
+
+// Dump writes the view as JSON to w, in the same format as Bus.Dump, and
+// encrypted with the keyring the bus had when the view was taken.
+func (v *View) Dump(w io.Writer) error {
+	ew, err := v.keyring.encrypter(w)
+	if err != nil {
+		return err
+	}
+	if err := v.dump(ew); err != nil {
+		return err
+	}
+
+	return ew.Close()
+}
+
+// dump writes the view as plain JSON to w.
+func (v *View) dump(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(dump{
+		Format:    DumpFormat,
+		Compat:    dumpCompat,
+		Events:    v.events,
+		Scheduled: v.scheduled,
+	})
+}
@@ -0,0 +1,322 @@
+package eventbus
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// SyncMode tells a WAL when to flush appended events to stable storage.
+type SyncMode int
+
+const (
+	// SyncAlways flushes and syncs the file on every append, so that a
+	// published event survives a crash of the machine.
+	SyncAlways SyncMode = iota
+
+	// SyncInterval flushes and syncs the file periodically, losing at most
+	// the last interval of events on a crash.
+	SyncInterval
+
+	// SyncOnClose only flushes and syncs the file when the WAL is closed,
+	// which survives clean shutdowns only, like SaveToFile on exit, but
+	// without rewriting the whole log.
+	SyncOnClose
+)
+
+// WAL is a Store that appends events to a file, one JSON object per line,
+// as a write-ahead log. Events appended together, such as those of a
+// transaction, share a single line holding a JSON array, so that a crash
+// keeps all of them or none:
+//
+//	wal, err := eventbus.OpenWAL("events.wal", eventbus.SyncAlways, 0)
+//	...
+//	bus, err := eventbus.NewWithStore(wal)
+//	...
+//	defer wal.Close()
+//	defer bus.Close()
+//
+// Payloads are recovered as generic JSON values, as with Load.
+type WAL struct {
+	mode SyncMode
+	keys *Keyring
+
+	mu     sync.Mutex
+	f      *os.File
+	w      *bufio.Writer
+	lastID string
+	n      int
+	err    error
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// OpenWAL opens the WAL at path, creating it if needed. interval is the
+// period of SyncInterval, one second if it is 0 or less, and is ignored by
+// other modes.
+//
+// An incomplete last line, left by a crash in the middle of an append, is
+// discarded. A new file is only readable and writable by its owner.
+func OpenWAL(path string, mode SyncMode, interval time.Duration) (*WAL, error) {
+	return OpenEncryptedWAL(path, mode, interval, nil)
+}
+
+// OpenEncryptedWAL is like OpenWAL, but encrypts each appended line with the
+// current key of keys, so that payloads are not stored in clear. Lines are
+// the base64 encoding of the encrypted event, and can be decrypted with any
+// key of the keyring; lines written in clear, before encryption was turned
+// on, are still read.
+func OpenEncryptedWAL(path string, mode SyncMode, interval time.Duration, keys *Keyring) (*WAL, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &WAL{mode: mode, keys: keys, f: f, w: bufio.NewWriter(f)}
+	size, err := w.recover()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	// drop a torn last line and append after the complete ones
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(size, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if mode == SyncInterval {
+		if interval <= 0 {
+			interval = time.Second
+		}
+		w.stop = make(chan struct{})
+		w.done = make(chan struct{})
+		go w.syncEvery(interval)
+	}
+
+	return w, nil
+}
+
+// recover reads the complete lines of the file to find the last ID and the
+// number of events, and returns the size of those lines.
+func (w *WAL) recover() (int64, error) {
+	var size int64
+	err := w.scan(func(e Event, end int64) error {
+		w.lastID = e.ID
+		w.n++
+		size = end
+		return nil
+	})
+	return size, err
+}
+
+// scan calls fn with each event of the complete lines of the file, and the
+// offset at the end of its line, which events of a batch share. It must be
+// called with w.mu held, or before the WAL is shared.
+func (w *WAL) scan(fn func(e Event, end int64) error) error {
+	r := bufio.NewReader(io.NewSectionReader(w.f, 0, 1<<62))
+
+	var offset int64
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// a line without newline was not completely written
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		offset += int64(len(line))
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if line[0] != '{' && line[0] != '[' {
+			if line, err = w.decrypt(line); err != nil {
+				return err
+			}
+		}
+
+		var batch []Event
+		if line[0] == '[' {
+			err = json.Unmarshal(line, &batch)
+		} else {
+			batch = make([]Event, 1)
+			err = json.Unmarshal(line, &batch[0])
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, e := range batch {
+			if err := fn(e, offset); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Append implements Store.
+func (w *WAL) Append(events ...Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+
+	// a single event keeps a line of its own, as in NDJSON dumps
+	var v any = events
+	if len(events) == 1 {
+		v = events[0]
+	}
+	line, err := w.encode(v)
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.w.Write(line); err != nil {
+		// the file may hold part of the line: refuse further appends
+		w.err = err
+		return err
+	}
+	if w.mode == SyncAlways {
+		if err := w.sync(); err != nil {
+			w.err = err
+			return err
+		}
+	}
+
+	w.lastID = events[len(events)-1].ID
+	w.n += len(events)
+
+	return nil
+}
+
+// encode returns the line of an event or a batch, with its newline.
+func (w *WAL) encode(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || w.keys == nil {
+		return append(data, '\n'), err
+	}
+
+	sealed, err := w.keys.seal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	line := make([]byte, base64.StdEncoding.EncodedLen(len(sealed)), base64.StdEncoding.EncodedLen(len(sealed))+1)
+	base64.StdEncoding.Encode(line, sealed)
+	return append(line, '\n'), nil
+}
+
+// decrypt returns the JSON of an encrypted line.
+func (w *WAL) decrypt(line []byte) ([]byte, error) {
+	sealed := make([]byte, base64.StdEncoding.DecodedLen(len(line)))
+	n, err := base64.StdEncoding.Decode(sealed, line)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid line", ErrDecrypt)
+	}
+	return w.keys.open(sealed[:n])
+}
+
+// ReadAfter implements Store.
+func (w *WAL) ReadAfter(id string, fn func(Event) error) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+
+	after := seqOf(id)
+	return w.scan(func(e Event, _ int64) error {
+		if id != "" && seqOf(e.ID) <= after {
+			return nil
+		}
+		return fn(e)
+	})
+}
+
+// LastID implements Store.
+func (w *WAL) LastID() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.lastID
+}
+
+// Len implements Store.
+func (w *WAL) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.n
+}
+
+// Sync flushes the appended events to stable storage, whatever the mode.
+func (w *WAL) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.sync()
+}
+
+// sync flushes and syncs the file. It must be called with w.mu held.
+func (w *WAL) sync() error {
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+	return w.f.Sync()
+}
+
+func (w *WAL) syncEvery(interval time.Duration) {
+	defer close(w.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.Sync()
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// Close syncs and closes the file. Close the bus first, so that nothing is
+// appended afterwards.
+func (w *WAL) Close() error {
+	if w.stop != nil {
+		close(w.stop)
+		<-w.done
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	err := w.sync()
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,78 @@
+package eventbus
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Where returns q with a payload filter added to PayloadFilter, selecting the
+// events whose payload has value at path:
+//
+//	q := eventbus.Query{Topic: "expenses"}.Where("category", "food")
+//
+// path locates a field as in Change.Path, such as "address.city" or
+// "items[2].qty", and an empty path selects the payload itself. Payloads and
+// value are compared as they would be encoded in JSON, so the filter works
+// the same for live structs and for the generic maps Load decodes, and the
+// number 3 equals 3.0. Events without the field are not selected. Calls can
+// be chained to require several fields.
+func (q Query) Where(path string, value any) Query {
+	want, err := normalize(value)
+	prev := q.PayloadFilter
+
+	q.PayloadFilter = func(payload any) bool {
+		if prev != nil && !prev(payload) {
+			return false
+		}
+		if err != nil {
+			return false
+		}
+
+		v, ok := field(payload, path)
+		return ok && reflect.DeepEqual(v, want)
+	}
+
+	return q
+}
+
+// field returns the JSON value at path in v, and false if there is none.
+// Generic maps and slices are walked as they are, and other values are
+// encoded only when reached, so that large payloads are not encoded whole.
+func field(v any, path string) (any, bool) {
+	for _, step := range strings.Split(strings.ReplaceAll(path, "[", ".["), ".") {
+		if step == "" {
+			continue
+		}
+
+		switch v.(type) {
+		case map[string]any, []any:
+		default:
+			var err error
+			if v, err = normalize(v); err != nil {
+				return nil, false
+			}
+		}
+
+		if index, ok := strings.CutPrefix(step, "["); ok {
+			list, ok := v.([]any)
+			i, err := strconv.Atoi(strings.TrimSuffix(index, "]"))
+			if !ok || err != nil || i < 0 || i >= len(list) {
+				return nil, false
+			}
+			v = list[i]
+			continue
+		}
+
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if v, ok = obj[step]; !ok {
+			return nil, false
+		}
+	}
+
+	v, err := normalize(v)
+	return v, err == nil
+}
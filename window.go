@@ -0,0 +1,169 @@
+package eventbus
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"time"
+)
+
+// Window is the aggregate of the events whose timestamp falls between Start,
+// included, and End, excluded.
+type Window[S any] struct {
+	Start  time.Time
+	End    time.Time
+	Events int
+	State  S
+}
+
+// Windows folds the events matching q into time windows of the given size,
+// such as revenue per hour:
+//
+//	hours := eventbus.Windows(bus, eventbus.Query{Type: "order_placed"}, time.Hour, 0, 0.0,
+//		func(sum float64, e eventbus.Event) float64 { return sum + e.Payload.(Order).Total })
+//
+// A new window starts every slide, aligned on multiples of slide since the
+// zero time, so a slide shorter than size gives overlapping sliding windows,
+// and a zero slide gives tumbling windows, one after the other. Each window
+// starts from initial, which apply must not modify in place, and counts its
+// events in Window.Events. Only windows with events are returned, oldest
+// first, the current one included.
+func Windows[S any](b *Bus, q Query, size, slide time.Duration, initial S, apply func(S, Event) S) []Window[S] {
+	w := newWindower(size, slide, initial, apply)
+	for e := range b.Events(q) {
+		w.add(e)
+	}
+
+	return w.flush(time.Time{})
+}
+
+// WatchWindows is like Windows, but keeps following new events until ctx is
+// done: emit is called with each window once its end has passed, oldest
+// first, from the calling goroutine. Windows of past events are emitted
+// first, and the current one when it ends. Events whose window was already
+// emitted, because their timestamp is late, are ignored.
+//
+// WatchWindows returns nil when ctx is done, and otherwise the error of
+// Tail.
+func WatchWindows[S any](ctx context.Context, b *Bus, q Query, size, slide time.Duration, initial S, apply func(S, Event) S, emit func(Window[S])) error {
+	w := newWindower(size, slide, initial, apply)
+
+	view := b.Snapshot()
+	for e := range view.Events(q) {
+		w.add(e)
+	}
+	if end := view.End(); end != "" {
+		q.AfterID = end
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	events := make(chan Event)
+	done := make(chan error, 1)
+	go func() {
+		done <- b.Tail(ctx, q, func(e Event) {
+			select {
+			case events <- e:
+			case <-ctx.Done():
+			}
+		})
+	}()
+
+	for {
+		for _, win := range w.flush(time.Now()) {
+			emit(win)
+		}
+
+		var tick <-chan time.Time
+		if next, ok := w.next(); ok {
+			tick = time.After(time.Until(next))
+		}
+
+		select {
+		case e := <-events:
+			w.add(e)
+		case <-tick:
+		case err := <-done:
+			return err
+		}
+	}
+}
+
+// windower folds events into the windows they belong to.
+type windower[S any] struct {
+	size    time.Duration
+	slide   time.Duration
+	initial S
+	apply   func(S, Event) S
+
+	// open holds the windows not emitted yet, by start time.
+	open map[int64]*Window[S]
+
+	// closed is the time up to which windows have been emitted.
+	closed time.Time
+}
+
+func newWindower[S any](size, slide time.Duration, initial S, apply func(S, Event) S) *windower[S] {
+	if slide <= 0 {
+		slide = size
+	}
+
+	return &windower[S]{
+		size:    size,
+		slide:   slide,
+		initial: initial,
+		apply:   apply,
+		open:    make(map[int64]*Window[S]),
+	}
+}
+
+// add applies e to every open window its timestamp falls in.
+func (w *windower[S]) add(e Event) {
+	t := e.Timestamp
+	for start := t.Truncate(w.slide); start.Add(w.size).After(t); start = start.Add(-w.slide) {
+		end := start.Add(w.size)
+		if !end.After(w.closed) {
+			break
+		}
+
+		win, ok := w.open[start.UnixNano()]
+		if !ok {
+			win = &Window[S]{Start: start, End: end, State: w.initial}
+			w.open[start.UnixNano()] = win
+		}
+		win.Events++
+		win.State = w.apply(win.State, e)
+	}
+}
+
+// flush removes and returns the windows ending at or before until, oldest
+// first, or every window if until is zero.
+func (w *windower[S]) flush(until time.Time) []Window[S] {
+	var windows []Window[S]
+	for _, k := range slices.Sorted(maps.Keys(w.open)) {
+		win := w.open[k]
+		if !until.IsZero() && win.End.After(until) {
+			continue
+		}
+		windows = append(windows, *win)
+		delete(w.open, k)
+	}
+
+	if until.After(w.closed) {
+		w.closed = until
+	}
+
+	return windows
+}
+
+// next returns the end of the open window that ends first.
+func (w *windower[S]) next() (time.Time, bool) {
+	var next time.Time
+	for _, win := range w.open {
+		if next.IsZero() || win.End.Before(next) {
+			next = win.End
+		}
+	}
+	return next, !next.IsZero()
+}